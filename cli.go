@@ -13,18 +13,27 @@ const (
 )
 
 var (
-	yesFlag    = flag.Bool("y", false, "run pack without confirmation")
-	actionFlag = flag.String("actions", "", "pack actions to run")
-	helpFlag   = flag.Bool("h", false, "show help and exit")
+	yesFlag       = flag.Bool("y", false, "run pack without confirmation")
+	actionFlag    = flag.String("actions", "", "pack actions to run")
+	helpFlag      = flag.Bool("h", false, "show help and exit")
+	dryRunFlag    = flag.Bool("dry-run", false, "report what tasks would change without changing anything")
+	checkFlag     = flag.Bool("check", false, "dry run which exits with 3 if any task reports drift")
+	logFormatFlag = flag.String("log-format", "text", "log format, text or json")
+	reportFlag    = flag.String("report", "", "path to save the json run report to")
+	tagsFlag      = flag.String("tags", "", "only run tasks with one of these tags")
+	skipTagsFlag  = flag.String("skip-tags", "", "skip tasks with one of these tags")
 )
 
 func usage() string {
 	x := filepath.Base(os.Args[0])
 	return fmt.Sprintf(`
 
-%s [-y] [--actions action1,action2] [property1.json property2.json ...]
+%s [-y] [--dry-run] [--check] [--log-format text|json] [--report report.json] [--tags tag1,tag2] [--skip-tags tag3] [--actions action1,action2] [property1.json property2.json ...]
 
   * attempts to load "gopack.json" if no property files are specified
+  * with tags only tasks tagged with one of them, and the tasks they run, are run
+  * exits with 1 on invalid arguments, 2 when the pack is stopped by a failed task,
+    130 when it is interrupted by SIGINT or SIGTERM and 3 when a check finds drift
 `, x)
 }
 
@@ -37,15 +46,22 @@ func CLI() (*Properties, []string) {
 		os.Exit(0)
 	}
 
-	actions := []string{}
-	if strings.TrimSpace(*actionFlag) != "" {
-		actions = strings.Split(*actionFlag, ",")
+	if *logFormatFlag != "text" && *logFormatFlag != "json" {
+		exitOnError(fmt.Errorf("log format %s not valid", *logFormatFlag))
 	}
 
+	// keep stdout for the json lines
+	out := os.Stdout
+	if *logFormatFlag == "json" {
+		out = os.Stderr
+	}
+
+	actions := splitList(*actionFlag)
+
 	confirm := *yesFlag
 	if !confirm {
 		response := ""
-		fmt.Fprint(os.Stdout, "Run pack (y/n)? ")
+		fmt.Fprint(out, "Run pack (y/n)? ")
 		fmt.Scanln(&response)
 		confirm = strings.TrimSpace(strings.ToLower(response)) == "y"
 	}
@@ -61,7 +77,7 @@ func CLI() (*Properties, []string) {
 		}
 
 		for idx, a := range args {
-			fmt.Fprintf(os.Stdout, packPropertyFormat, fmt.Sprintf("loading %s configuration file", a))
+			fmt.Fprintf(out, packPropertyFormat, fmt.Sprintf("loading %s configuration file", a))
 			p2 := Properties{}
 
 			f, err := os.Open(a)
@@ -86,6 +102,14 @@ func CLI() (*Properties, []string) {
 	return nil, actions
 }
 
+func splitList(s string) []string {
+	x := []string{}
+	if strings.TrimSpace(s) != "" {
+		x = strings.Split(s, ",")
+	}
+	return x
+}
+
 func exitOnError(err error) {
 	fmt.Fprint(os.Stderr, usage())
 	flag.PrintDefaults()
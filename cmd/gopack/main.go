@@ -16,6 +16,11 @@ usage: gopack encrypt --key <key> --file <file> --base64 <key=value>
 const decryptUsage = `
 usage: gopack decrypt --key <key> --base64 <encypted string>
 `
+const restoreUsage = `
+usage: gopack restore [--dir <backup dir>] [-y] <file> [backup]
+
+  * lists the backups of the file if no backup is provided
+`
 
 var (
 	generateFlags  = flag.NewFlagSet("generate", flag.ContinueOnError)
@@ -30,6 +35,10 @@ var (
 	decryptFlags     = flag.NewFlagSet("decrypt", flag.ContinueOnError)
 	keyDecrypt       = decryptFlags.String("key", "", "key to use for decryption")
 	base64KeyDecrypt = decryptFlags.Bool("base64", false, "key is base64 encoded otherwise defaults to hex encoding")
+
+	restoreFlags = flag.NewFlagSet("restore", flag.ContinueOnError)
+	dirRestore   = restoreFlags.String("dir", "", "backup directory, defaults to the file's directory")
+	yesRestore   = restoreFlags.Bool("y", false, "restore without confirmation")
 )
 
 func main() {
@@ -48,6 +57,11 @@ func main() {
 		decryptFlags.PrintDefaults()
 	}
 
+	restoreFlags.Usage = func() {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		restoreFlags.PrintDefaults()
+	}
+
 	command := ""
 	if len(os.Args) >= 2 {
 		command = os.Args[1]
@@ -105,6 +119,20 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "restore":
+		if err := restoreFlags.Parse(os.Args[2:]); err != nil {
+			os.Exit(1)
+		}
+		if restoreFlags.NArg() < 1 {
+			fmt.Fprintln(os.Stderr, "file path not provided")
+			restoreFlags.Usage()
+			os.Exit(1)
+		}
+		if err := restore(restoreFlags.Arg(0), restoreFlags.Arg(1), *dirRestore, *yesRestore); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
 	default:
 		m := fmt.Sprintf("%s is not a valid command", command)
 		if command == "" {
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mschenk42/gopack/task"
+)
+
+func restore(path, backup, dir string, force bool) error {
+	b := task.Backup{Dir: dir}
+	if backup == "" {
+		backups, err := b.List(path)
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			return fmt.Errorf("no backups of %s found", path)
+		}
+		for _, x := range backups {
+			fmt.Println(filepath.Base(x))
+		}
+		return nil
+	}
+	if !force && !confirm(fmt.Sprintf("Restore %s from %s (y/n)? ", path, backup)) {
+		return nil
+	}
+	return b.Restore(path, backup)
+}
@@ -0,0 +1,321 @@
+package gopack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mschenk42/gopack/action"
+)
+
+// ErrInterrupted is returned when a run is stopped because its context was canceled
+var ErrInterrupted = errors.New("interrupted")
+
+// RunContext holds the state of a pack run, the delayed notifications, the summary of tasks run, the log
+// indentation and the reporter of run events.
+// Tasks run concurrently with the same RunContext share its log indentation, use Fork to give each its own.
+type RunContext struct {
+	Log      *log.Logger
+	Reporter Reporter
+	DryRun   bool
+
+	// Tags selects the tasks with one of the tags, SkipTags skips the tasks with one of the tags
+	Tags     []string
+	SkipTags []string
+
+	ctx         context.Context
+	state       *runState
+	indentLevel int
+	topLevel    int
+	changes     int
+	tagged      bool
+}
+
+// runState is shared by a run context and its forks, its lock also guards the indentation and tag selection
+// of the run contexts
+type runState struct {
+	sync.Mutex
+	delayedNotify taskRunSet
+	tasksRun      []Event
+	drifts        int
+	// noSummary is set for DefaultRunContext which is never reset, so its tasks run aren't kept
+	noSummary bool
+}
+
+func newRunState() *runState {
+	return &runState{
+		delayedNotify: taskRunSet{},
+		tasksRun:      []Event{},
+	}
+}
+
+// DefaultRunContext is used by tasks which are not given a RunContext, it doesn't keep a summary of tasks run
+var DefaultRunContext = newDefaultRunContext()
+
+func newDefaultRunContext() *RunContext {
+	rc := NewRunContext(nil)
+	rc.state.noSummary = true
+	return rc
+}
+
+// NewRunContext returns a run context which logs text to logger, Log is used if logger is nil
+func NewRunContext(logger *log.Logger) *RunContext {
+	return &RunContext{
+		Log:      logger,
+		state:    newRunState(),
+		topLevel: 1,
+	}
+}
+
+// Fork returns a run context for tasks run concurrently with the tasks of r. The fork shares the
+// delayed notifications, summary and reporter of r, and its top most tasks are nested under r's current task
+// so they're part of it in the summary.
+func (r *RunContext) Fork() *RunContext {
+	r.state.Lock()
+	defer r.state.Unlock()
+	fork := *r
+	fork.topLevel = r.indentLevel + 1
+	fork.changes = 0
+	return &fork
+}
+
+// Context returns the context which cancels the run, context.Background is returned if none was set
+func (r *RunContext) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext sets the context which cancels the run, tasks not yet started are skipped once it's done
+func (r *RunContext) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// Run runs the task's actions with r as the task's run context, the task's own RunContext is used if it has one.
+// The task is copied so the task given isn't changed, a task given as a pointer is run as a pointer.
+func (r *RunContext) Run(task Runner, actions ...action.Name) ActionRunStatus {
+	return withRunContext(task, r).Run(actions...)
+}
+
+// withRunContext returns a copy of the task with rc as its RunContext if the task embeds a BaseTask without one
+func withRunContext(task Runner, rc *RunContext) Runner {
+	v := reflect.ValueOf(task)
+	isPtr := v.Kind() == reflect.Ptr
+	if isPtr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return task
+	}
+	b := v.FieldByName("BaseTask")
+	if !b.IsValid() || b.Type() != reflect.TypeOf(BaseTask{}) || !b.FieldByName("RunContext").IsNil() {
+		return task
+	}
+	x := reflect.New(v.Type())
+	x.Elem().Set(v)
+	x.Elem().FieldByName("BaseTask").FieldByName("RunContext").Set(reflect.ValueOf(rc))
+	if isPtr {
+		return x.Interface().(Runner)
+	}
+	return x.Elem().Interface().(Runner)
+}
+
+// Interrupted returns true if the run's context was canceled
+func (r *RunContext) Interrupted() bool {
+	return r.Context().Err() != nil
+}
+
+// RunDelayed runs the delayed notifications and returns the task error which stopped them
+func (r *RunContext) RunDelayed() (err error) {
+	defer recoverTaskError(&err)
+	// a failed task leaves its delayed notifications behind, don't run them later
+	defer func() {
+		if err != nil {
+			r.state.Lock()
+			r.state.delayedNotify = taskRunSet{}
+			r.state.Unlock()
+		}
+	}()
+	// running delayed tasks can queue new delayed tasks
+	for {
+		key, f := r.nextDelayed()
+		if f == nil {
+			return nil
+		}
+		f()
+		r.state.Lock()
+		delete(r.state.delayedNotify, key)
+		r.state.Unlock()
+	}
+}
+
+// TasksRun returns the changed events of the top most tasks which have run
+func (r *RunContext) TasksRun() []Event {
+	r.state.Lock()
+	defer r.state.Unlock()
+	return append([]Event{}, r.state.tasksRun...)
+}
+
+// Report sends the event to the reporter, the event's time, depth and dry run are set from the context
+func (r *RunContext) Report(e Event) {
+	e.Time = time.Now()
+	e.DryRun = r.DryRun
+
+	r.state.Lock()
+	defer r.state.Unlock()
+	e.Depth = r.indentLevel
+	if e.Kind == EventTaskChanged && r.indentLevel == r.topLevel {
+		r.changes++
+	}
+	// the tasks of a fork are part of the task which forked, like the nested tasks of any task
+	if e.Kind == EventTaskChanged && r.indentLevel == 1 && !r.state.noSummary {
+		r.state.tasksRun = append(r.state.tasksRun, e)
+	}
+	if e.Kind == EventTaskWould && e.Drift != nil {
+		r.state.drifts++
+	}
+	r.reporter().Report(e)
+}
+
+// drifted returns true if a task reported the drift of a resource it would change
+func (r *RunContext) drifted() bool {
+	r.state.Lock()
+	defer r.state.Unlock()
+	return r.state.drifts > 0
+}
+
+// NewTaskInfoWriter returns a writer which logs each line at the current indentation
+func (r *RunContext) NewTaskInfoWriter() io.Writer {
+	return taskInfoWriter{r}
+}
+
+// enter indents the log for the actions of a task and returns a func which outdents it once they have run
+func (r *RunContext) enter() func() {
+	r.state.Lock()
+	defer r.state.Unlock()
+	r.indentLevel++
+	return func() {
+		r.state.Lock()
+		defer r.state.Unlock()
+		r.indentLevel--
+	}
+}
+
+// changed returns true if a top most task of the context has changed
+func (r *RunContext) changed() bool {
+	r.state.Lock()
+	defer r.state.Unlock()
+	return r.changes > 0
+}
+
+// selectTags returns true if a task with tags should run, tasks run by a task selected by its tags are selected.
+// The returned func restores the selection once the task has run.
+func (r *RunContext) selectTags(tags []string) (bool, func()) {
+	r.state.Lock()
+	defer r.state.Unlock()
+	restore := r.restoreTagged(r.tagged)
+	if hasTag(r.SkipTags, tags) {
+		return false, restore
+	}
+	if len(r.Tags) == 0 || r.tagged {
+		return true, restore
+	}
+	r.tagged = hasTag(r.Tags, tags)
+	return r.tagged, restore
+}
+
+// isTagged returns true if the task being run was selected by its tags
+func (r *RunContext) isTagged() bool {
+	r.state.Lock()
+	defer r.state.Unlock()
+	return r.tagged
+}
+
+// setTagged sets the tag selection and returns a func which restores the previous one
+func (r *RunContext) setTagged(tagged bool) func() {
+	r.state.Lock()
+	defer r.state.Unlock()
+	restore := r.restoreTagged(r.tagged)
+	r.tagged = tagged
+	return restore
+}
+
+func (r *RunContext) restoreTagged(tagged bool) func() {
+	return func() {
+		r.state.Lock()
+		defer r.state.Unlock()
+		r.tagged = tagged
+	}
+}
+
+func hasTag(x, tags []string) bool {
+	for _, t := range tags {
+		for _, y := range x {
+			if t == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *RunContext) nextDelayed() (string, func()) {
+	r.state.Lock()
+	defer r.state.Unlock()
+	for k, f := range r.state.delayedNotify {
+		return k, f
+	}
+	return "", nil
+}
+
+func (r *RunContext) queueDelayed(key string, f func()) {
+	r.state.Lock()
+	defer r.state.Unlock()
+	r.state.delayedNotify[key] = f
+}
+
+func (r *RunContext) reset() {
+	r.state = newRunState()
+	r.indentLevel = 0
+	r.topLevel = 1
+	r.changes = 0
+}
+
+func (r *RunContext) logWriter() io.Writer {
+	if r.Log != nil {
+		return r.Log.Writer()
+	}
+	return Log.Writer()
+}
+
+func (r *RunContext) reporter() Reporter {
+	if r.Reporter != nil {
+		return r.Reporter
+	}
+	return TextReporter{Log: r.Log}
+}
+
+// NewTaskInfoWriter returns a task info writer for the default run context
+func NewTaskInfoWriter() io.Writer {
+	return DefaultRunContext.NewTaskInfoWriter()
+}
+
+type taskInfoWriter struct {
+	rc *RunContext
+}
+
+func (t taskInfoWriter) Write(b []byte) (int, error) {
+	buf := bytes.NewBuffer(b)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		t.rc.Report(Event{Kind: EventTaskInfo, Text: scanner.Text()})
+	}
+	return len(b), nil
+}
@@ -0,0 +1,14 @@
+package gopack
+
+import "errors"
+
+// ErrDrift is returned by a pack run in check mode when tasks report drift
+var ErrDrift = errors.New("drift detected, tasks would change")
+
+// Drift describes how a resource differs from the state a task would change it to
+type Drift struct {
+	Resource string `json:"resource"`
+	Attr     string `json:"attr"`
+	Have     string `json:"have"`
+	Want     string `json:"want"`
+}
@@ -0,0 +1,179 @@
+package gopack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mschenk42/gopack/action"
+)
+
+// Graph is a task which runs its tasks concurrently, a task is started once the tasks it requires have run.
+// Each task func is given a forked RunContext which the tasks it runs should use, e.g. with rc.Run(task, actions...),
+// so their log indentation, tag selection and changes are kept apart from the other tasks run at the same time.
+type Graph struct {
+	Name    string
+	Workers int
+
+	nodes []graphNode
+	BaseTask
+}
+
+type graphNode struct {
+	name     string
+	requires []string
+	run      func(rc *RunContext)
+}
+
+type graphResult struct {
+	name    string
+	changed bool
+	err     error
+}
+
+// Add registers the func which runs the named task after the tasks it requires have run
+func (g *Graph) Add(name string, f func(rc *RunContext), requires ...string) {
+	g.nodes = append(g.nodes, graphNode{name: name, requires: requires, run: f})
+}
+
+// Run initializes default property values and delegates to BaseTask RunActions method
+func (g Graph) Run(runActions ...action.Name) ActionRunStatus {
+	g.setDefaults()
+	return g.RunActions(&g, g.registerActions(), runActions)
+}
+
+func (g Graph) registerActions() action.Funcs {
+	return action.Funcs{
+		action.Run: g.run,
+	}
+}
+
+func (g *Graph) setDefaults() {
+	if g.Workers <= 0 {
+		g.Workers = 1
+	}
+}
+
+// String returns a string which identifies the task with it's property values
+func (g Graph) String() string {
+	return fmt.Sprintf("graph %s %d", g.Name, g.Workers)
+}
+
+// Validate returns an error if a task is added more than once, requires an unknown task
+// or the tasks' requirements form a cycle
+func (g Graph) Validate() error {
+	nodes := map[string]graphNode{}
+	for _, n := range g.nodes {
+		if _, found := nodes[n.name]; found {
+			return fmt.Errorf("task %s added more than once", n.name)
+		}
+		nodes[n.name] = n
+	}
+	for _, n := range g.nodes {
+		for _, r := range n.requires {
+			if _, found := nodes[r]; !found {
+				return fmt.Errorf("task %s requires unknown task %s", n.name, r)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	path := []string{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle %s -> %s", strings.Join(path, " -> "), name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, r := range nodes[name].requires {
+			if err := visit(r); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, n := range g.nodes {
+		if err := visit(n.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g Graph) run() (bool, error) {
+	if err := g.Validate(); err != nil {
+		return false, err
+	}
+
+	var (
+		rc         = g.Ctx()
+		waiting    = map[string]int{}
+		dependents = map[string][]graphNode{}
+		ready      = []graphNode{}
+		results    = make(chan graphResult)
+		running    int
+		changed    bool
+		err        error
+	)
+	for _, n := range g.nodes {
+		waiting[n.name] = len(n.requires)
+		for _, r := range n.requires {
+			dependents[r] = append(dependents[r], n)
+		}
+		if len(n.requires) == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	for {
+		// stop scheduling tasks once a task has failed or the run is interrupted
+		for err == nil && !rc.Interrupted() && len(ready) > 0 && running < g.Workers {
+			n := ready[0]
+			ready = ready[1:]
+			running++
+			go func(n graphNode, rc *RunContext) {
+				results <- runGraphNode(n, rc)
+			}(n, rc.Fork())
+		}
+		if running == 0 {
+			break
+		}
+		r := <-results
+		running--
+		if r.err != nil {
+			if err == nil {
+				err = r.err
+			}
+			continue
+		}
+		changed = changed || r.changed
+		for _, n := range dependents[r.name] {
+			waiting[n.name]--
+			if waiting[n.name] == 0 {
+				ready = append(ready, n)
+			}
+		}
+	}
+	if err == nil && rc.Interrupted() {
+		err = ErrInterrupted
+	}
+	return changed, err
+}
+
+func runGraphNode(n graphNode, rc *RunContext) (r graphResult) {
+	r.name = n.name
+	defer recoverTaskError(&r.err)
+	n.run(rc)
+	r.changed = rc.changed()
+	return r
+}
@@ -0,0 +1,150 @@
+package gopack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphRun(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+
+	var (
+		mu       sync.Mutex
+		order    []string
+		started  = make(chan bool)
+		parallel bool
+	)
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+
+	g := Graph{Name: "provision", Workers: 2, BaseTask: BaseTask{RunContext: rc}}
+	g.Add("a", func(rc *RunContext) {
+		// wait for b to show a and b run at the same time
+		select {
+		case <-started:
+			parallel = true
+		case <-time.After(time.Second):
+		}
+		Task1{Name: "task a", BaseTask: BaseTask{RunContext: rc}}.Run(action.Create)
+		record("a")
+	})
+	g.Add("b", func(rc *RunContext) {
+		started <- true
+		t2 := Task2{Name: "task b notified", BaseTask: BaseTask{RunContext: rc}}
+		t1 := Task1{Name: "task b", BaseTask: BaseTask{RunContext: rc}}
+		t1.SetNotify(t2, action.Create, action.Create, true)
+		t1.Run(action.Create)
+		record("b")
+	})
+	g.Add("c", func(rc *RunContext) {
+		Task2{Name: "task c", BaseTask: BaseTask{RunContext: rc}}.Run(action.Nothing)
+		record("c")
+	}, "a", "b")
+
+	var status ActionRunStatus
+	assert.NotPanics(func() { status = g.Run() })
+	assert.True(status[action.Run])
+	assert.True(parallel, "a and b should run concurrently")
+	assert.Len(order, 3)
+	assert.Equal("c", order[2])
+
+	assert.NoError(rc.RunDelayed())
+	assert.Regexp(fmt.Sprintf(`task b notified.*create.*%s`, passKeywords), buf.String())
+	assert.Regexp(`  task a: create`, buf.String())
+
+	summary := []string{}
+	for _, e := range rc.TasksRun() {
+		summary = append(summary, e.Task.String())
+	}
+	assert.Equal([]string{"graph provision 2"}, summary)
+	fmt.Print(buf.String())
+}
+
+func TestGraphConcurrentTasks(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	rc.SkipTags = []string{"slow"}
+
+	g := Graph{Name: "concurrent", Workers: 4, BaseTask: BaseTask{RunContext: rc}}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("node%d", i)
+		g.Add(name, func(rc *RunContext) {
+			// tasks without a run context share the default run context
+			Task1{Name: "unwired " + name}.Run(action.Create)
+			rc.Run(Task1{Name: "task " + name}, action.Create)
+			rc.Run(Task1{Name: "slow " + name, BaseTask: BaseTask{Tags: []string{"slow"}}}, action.Create)
+		})
+	}
+
+	var status ActionRunStatus
+	assert.NotPanics(func() { status = g.Run(action.Run) })
+	assert.True(status[action.Run])
+	for i := 0; i < 8; i++ {
+		assert.Regexp(fmt.Sprintf(`(?m)^  task node%d: create.*\(has run\)`, i), buf.String())
+		assert.Regexp(fmt.Sprintf(`(?m)^  slow node%d: \[create\] \(skipped due to tags\)`, i), buf.String())
+	}
+	assert.NotRegexp(`unwired`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestGraphCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+
+	ran := false
+	g := Graph{Name: "cycle", BaseTask: BaseTask{RunContext: rc}}
+	g.Add("a", func(rc *RunContext) { ran = true }, "c")
+	g.Add("b", func(rc *RunContext) { ran = true }, "a")
+	g.Add("c", func(rc *RunContext) { ran = true }, "b")
+	g.Add("d", func(rc *RunContext) { ran = true })
+
+	assert.EqualError(g.Validate(), "dependency cycle a -> c -> b -> a")
+	_, err := RunE(g)
+	assert.Error(err)
+	assert.False(ran)
+
+	g = Graph{Name: "unknown", BaseTask: BaseTask{RunContext: rc}}
+	g.Add("a", func(rc *RunContext) {}, "x")
+	assert.EqualError(g.Validate(), "task a requires unknown task x")
+	fmt.Print(buf.String())
+}
+
+func TestGraphTaskError(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+
+	ran := false
+	g := Graph{Name: "failing", Workers: 4, BaseTask: BaseTask{RunContext: rc}}
+	g.Add("a", func(rc *RunContext) {
+		Task2{Name: "task a", BaseTask: BaseTask{RunContext: rc}}.Run()
+	})
+	g.Add("b", func(rc *RunContext) { ran = true }, "a")
+
+	_, err := RunE(g)
+	assert.Error(err)
+	te := &TaskError{}
+	assert.True(errors.As(err.(*TaskError).Err, &te))
+	assert.Equal("task a", te.Task.String())
+	assert.False(ran)
+	fmt.Print(buf.String())
+}
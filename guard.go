@@ -0,0 +1,41 @@
+package gopack
+
+import "fmt"
+
+// Guard is a condition which decides if a task's actions are run, Desc identifies the guard in the log.
+// A task's actions are run when all of its only_if guards are true and all of its not_if guards are false.
+type Guard struct {
+	Desc string
+	Cond func() (bool, error)
+}
+
+// AddOnlyIf adds a guard, the task's actions are only run if the guard is true
+func (b *BaseTask) AddOnlyIf(g Guard) {
+	b.onlyIf = append(b.onlyIf, g)
+}
+
+// AddNotIf adds a guard, the task's actions are not run if the guard is true
+func (b *BaseTask) AddNotIf(g Guard) {
+	b.notIf = append(b.notIf, g)
+}
+
+func (b BaseTask) onlyIfGuards() []Guard {
+	if b.OnlyIf == nil {
+		return b.onlyIf
+	}
+	return append([]Guard{{Cond: b.OnlyIf}}, b.onlyIf...)
+}
+
+func (b BaseTask) notIfGuards() []Guard {
+	if b.NotIf == nil {
+		return b.notIf
+	}
+	return append([]Guard{{Cond: b.NotIf}}, b.notIf...)
+}
+
+func (g Guard) reason(kind string) string {
+	if g.Desc == "" {
+		return fmt.Sprintf("due to %s", kind)
+	}
+	return fmt.Sprintf("due to %s %s", kind, g.Desc)
+}
@@ -0,0 +1,106 @@
+package gopack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mschenk42/gopack/action"
+)
+
+// taskIdentity is shared by the copies of a task, it identifies the task for notifications
+type taskIdentity struct{ _ byte }
+
+// SetNotify runs the notify task's forAction when the task's whenAction has run,
+// delayed notifications are run once at the end of the pack no matter how often they're notified
+func (b *BaseTask) SetNotify(notify Task, forAction, whenAction action.Name, delayed bool) {
+	b.identify()
+	identify(notify)
+	if b.notify == nil {
+		b.notify = actionTaskRunSet{}
+	}
+	if b.notify[whenAction] == nil {
+		b.notify[whenAction] = map[string]func(rc *RunContext){}
+	}
+	b.notify[whenAction][notifyKey(notify, forAction)] = notifyFunc(notify, forAction, delayed)
+}
+
+// Notifier is a task which notifies other tasks, tasks embedding BaseTask given as a pointer are notifiers
+type Notifier interface {
+	SetNotify(notify Task, forAction, whenAction action.Name, delayed bool)
+}
+
+// SetSubscribe runs task's forAction when the source task's whenAction has run, it's the reverse of
+// SetNotify and it's kept by the source like the tasks it notifies. task is the task embedding b, b
+// can't run it so it has to be given, e.g. t.SetSubscribe(&t, &source, action.Create, action.Restart, true).
+// Give a pointer to the source so the subscription is kept by the source's copies when they run.
+func (b *BaseTask) SetSubscribe(task Task, source Notifier, whenAction, forAction action.Name, delayed bool) {
+	b.identify()
+	source.SetNotify(task, forAction, whenAction, delayed)
+}
+
+func (b BaseTask) notifyTasks(task Task, a action.Name) {
+	rc := b.Ctx()
+	for _, f := range b.notify[a] {
+		f(rc)
+	}
+}
+
+// notifyFunc returns the func which runs the notified task, with the notifying task's run context if it has none
+func notifyFunc(notify Task, forAction action.Name, delayed bool) func(rc *RunContext) {
+	if delayed {
+		return func(rc *RunContext) {
+			// the notified task is selected by the tags of the notifying task
+			tagged := rc.isTagged()
+			rc.queueDelayed(notifyKey(notify, forAction), func() {
+				defer rc.setTagged(tagged)()
+				rc.Report(Event{Kind: EventNotify, Task: notify, Actions: action.NewSlice(forAction), Reason: "delayed"})
+				rc.Run(notify, forAction)
+			})
+		}
+	}
+	return func(rc *RunContext) {
+		rc.Report(Event{Kind: EventNotify, Task: notify, Actions: action.NewSlice(forAction), Reason: "immediately"})
+		rc.Run(notify, forAction)
+	}
+}
+
+func notifyKey(t Task, a action.Name) string {
+	return fmt.Sprintf("%s:%s", taskKey(t), a)
+}
+
+func (b BaseTask) identity() *taskIdentity {
+	return b.id
+}
+
+func (b *BaseTask) identify() {
+	if b.id == nil {
+		b.id = &taskIdentity{}
+	}
+}
+
+// identify gives a task given as a pointer an identity which is shared by its copies
+func identify(t Task) {
+	if x, ok := t.(interface{ identify() }); ok {
+		x.identify()
+	}
+}
+
+// taskKey identifies a task by its identity, tasks without one are identified by their type and property values
+func taskKey(t Task) string {
+	if x, ok := t.(interface{ identity() *taskIdentity }); ok && x.identity() != nil {
+		return fmt.Sprintf("%p", x.identity())
+	}
+	v := reflect.Indirect(reflect.ValueOf(t))
+	if v.Kind() != reflect.Struct {
+		return fmt.Sprintf("%T%#v", t, t)
+	}
+	fields := []string{}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Type == reflect.TypeOf(BaseTask{}) {
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%#v", v.Field(i)))
+	}
+	return fmt.Sprintf("%s{%s}", v.Type(), strings.Join(fields, ", "))
+}
@@ -1,16 +1,29 @@
 package gopack
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
-
-	"github.com/mschenk42/gopack/color"
 )
 
 var Log = log.New(os.Stdout, "", 0)
 
+// Exit codes used by Pack.Run
+const (
+	// ExitInvalidArgs is used when the pack is run with an action it doesn't have
+	ExitInvalidArgs = 1
+	// ExitTaskFailed is used when the pack is stopped by a failed task
+	ExitTaskFailed = 2
+	// ExitInterrupted is used when the pack is stopped by SIGINT or SIGTERM
+	ExitInterrupted = 130
+	// ExitDrift is used when a pack run in check mode finds tasks which would change
+	ExitDrift = 3
+)
+
 type Pack struct {
 	Name         string
 	Props        *Properties
@@ -18,54 +31,152 @@ type Pack struct {
 	Actions      []string
 	ActionMap    map[string]func(p *Pack)
 	NoRunDelayed bool
+	DryRun       bool
+	Check        bool
+	RunContext   *RunContext
+	ReportPath   string
+	NoSignals    bool
+	Tags         []string
+	SkipTags     []string
 }
 
-var (
-	packHeaderFormat       = color.Blue("\nPack: %s (%s) %s")
-	packSectionFormat      = color.Blue("\n[%s %s]\n")
-	packErrorFormat        = color.Red("! %s\n")
-	packPropertyFormat     = color.Magenta("%s")
-	packActionHeaderFormat = color.Blue("Pack: %s %s (%s) %s")
-)
+// ActionNotFoundError is returned when a pack is run with an action which isn't in its ActionMap
+type ActionNotFoundError struct {
+	Action string
+}
+
+func (e *ActionNotFoundError) Error() string {
+	return fmt.Sprintf("pack action %s not found", e.Action)
+}
 
 func (p Pack) String() string {
 	return fmt.Sprintf("%s", p.Name)
 }
 
+// Run runs the pack and exits with ExitTaskFailed if the pack is stopped by a failed task,
+// ExitInterrupted if the pack is stopped by a signal or ExitInvalidArgs if an action isn't found,
+// in check mode it exits with ExitDrift if tasks report drift
 func (p *Pack) Run(props *Properties) {
+	if err := p.RunE(props); err != nil {
+		var notFound *ActionNotFoundError
+		if errors.As(err, &notFound) {
+			os.Exit(ExitInvalidArgs)
+		}
+		if err == ErrInterrupted {
+			os.Exit(ExitInterrupted)
+		}
+		if err == ErrDrift {
+			os.Exit(ExitDrift)
+		}
+		os.Exit(ExitTaskFailed)
+	}
+}
+
+// RunE runs the pack and returns the error which stopped it, the summary of tasks run is always reported.
+// The pack's RunContext is used for the run, a new one is created if the pack has none. The actions give
+// it to the tasks they run, with BaseTask{RunContext: p.RunContext} or p.RunContext.Run(task, actions...),
+// tasks without a RunContext use DefaultRunContext and aren't part of the run.
+// Check or the check flag runs the pack as a dry run, ErrDrift is returned if any task reported drift,
+// the changes tasks would make without drift, e.g. commands, are unknown and not counted.
+// If ReportPath or the report flag is set a run report is saved to it before the pack ends.
+// Only the tasks selected by Tags or the tags flag are run, tasks with one of SkipTags or the skip tags flag are skipped.
+// Unless NoSignals is set, SIGINT and SIGTERM cancel the run's context, tasks not yet started are
+// skipped, the running command is stopped and ErrInterrupted is returned.
+func (p *Pack) RunE(props *Properties) error {
+	if p.RunContext == nil {
+		p.RunContext = NewRunContext(nil)
+	}
+	rc := p.RunContext
+	rc.reset()
+	check := p.Check || *checkFlag
+	rc.DryRun = p.DryRun || *dryRunFlag || check
+	rc.Tags = p.Tags
+	if len(rc.Tags) == 0 {
+		rc.Tags = splitList(*tagsFlag)
+	}
+	rc.SkipTags = p.SkipTags
+	if len(rc.SkipTags) == 0 {
+		rc.SkipTags = splitList(*skipTagsFlag)
+	}
+	if !p.NoSignals {
+		parent := rc.ctx
+		ctx, stop := signal.NotifyContext(rc.Context(), os.Interrupt, syscall.SIGTERM)
+		rc.SetContext(ctx)
+		defer func() {
+			stop()
+			rc.SetContext(parent)
+		}()
+	}
+	if rc.Reporter == nil && *logFormatFlag == "json" {
+		rc.Reporter = NewJSONReporter(rc.logWriter())
+	}
+
+	reportPath := p.ReportPath
+	if reportPath == "" {
+		reportPath = *reportFlag
+	}
+
 	t := time.Now()
 	p.Props.Merge(props)
-	Log.Printf(packHeaderFormat, p, "start", "")
-	Log.Printf(packPropertyFormat, p.Props.Redact(p.Redact))
-	Log.Printf(packSectionFormat, "run actions for", p)
+	redacted := p.Props.Redact(p.Redact)
+
+	var report *RunReport
+	if reportPath != "" {
+		report = newRunReport(p, redacted, rc.DryRun, t)
+		saveReporter := rc.Reporter
+		rc.Reporter = MultiReporter{rc.reporter(), reportRecorder{report}}
+		defer func() { rc.Reporter = saveReporter }()
+	}
 
-	p.run()
+	rc.Report(Event{Kind: EventPackStart, Pack: p, Props: redacted})
+
+	err := p.run()
+	if rc.Interrupted() {
+		err = ErrInterrupted
+	}
 	if !p.NoRunDelayed {
-		Log.Printf(packSectionFormat, "run delayed tasks for", p)
-		delayedNotify.Run()
+		if err == nil {
+			rc.Report(Event{Kind: EventDelayedFlush, Pack: p})
+			err = rc.RunDelayed()
+			if rc.Interrupted() {
+				err = ErrInterrupted
+			}
+		} else if err == ErrInterrupted {
+			rc.Report(Event{Kind: EventDelayedFlush, Pack: p, Reason: "due to interrupt"})
+		} else {
+			rc.Report(Event{Kind: EventDelayedFlush, Pack: p, Reason: "due to error"})
+		}
 	}
 
-	Log.Printf(packSectionFormat, "summary of tasks run for", p)
-	for _, x := range tasksRun {
-		Log.Print(x)
+	if check && err == nil && rc.drifted() {
+		err = ErrDrift
+	}
+
+	if report != nil {
+		report.finish(time.Now(), err)
+		if rerr := report.Save(reportPath); rerr != nil && err == nil {
+			err = fmt.Errorf("unable to save run report %s, %s", reportPath, rerr)
+		}
 	}
 
-	Log.Printf(packHeaderFormat, p, "end", time.Since(t))
-	Log.Print("")
+	rc.Report(Event{Kind: EventPackEnd, Pack: p, Err: err, Elapsed: time.Since(t), Summary: rc.TasksRun()})
+	return err
 }
 
-func (p *Pack) run() {
+func (p *Pack) run() (err error) {
+	defer recoverTaskError(&err)
 	if len(p.Actions) == 0 {
 		p.ActionMap["default"](p)
 	}
 	for _, action := range p.Actions {
 		if f, found := p.ActionMap[action]; found {
 			t := time.Now()
-			Log.Printf(packActionHeaderFormat, p, action, "start", "")
+			p.RunContext.Report(Event{Kind: EventActionStart, Pack: p, Text: action})
 			f(p)
-			Log.Printf(packActionHeaderFormat, p, action, "end", time.Since(t))
+			p.RunContext.Report(Event{Kind: EventActionEnd, Pack: p, Text: action, Elapsed: time.Since(t)})
 		} else {
-			Log.Fatalf(packErrorFormat, fmt.Sprintf("pack action %s not found", action))
+			return &ActionNotFoundError{Action: action}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,299 @@
+package gopack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackRunTaskError(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := Log
+	buf := &bytes.Buffer{}
+	Log = log.New(buf, "", 0)
+	defer func() { Log = saveLogger }()
+
+	pack := Pack{
+		Name:  "pack1",
+		Props: &Properties{},
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				Task1{Name: "task1"}.Run(action.Create)
+				Task2{Name: "task2"}.Run()
+				Task1{Name: "task3"}.Run(action.Create)
+			},
+		},
+	}
+
+	var err error
+	assert.NotPanics(func() { err = pack.RunE(nil) })
+	assert.Error(err)
+
+	te := &TaskError{}
+	assert.True(errors.As(err, &te))
+	assert.Equal("task2", te.Task.String())
+	assert.Regexp(`unable to run, no action given`, te.Err.Error())
+
+	assert.Regexp(`summary of tasks run for pack1`, buf.String())
+	assert.Regexp(`task1.*create.*\(has run\)`, buf.String())
+	assert.NotRegexp(`task3`, buf.String())
+	assert.Regexp(`Pack: pack1 \(failed\)`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestPackActionNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{},
+		Actions:    []string{"missing"},
+		RunContext: NewRunContext(log.New(ioutil.Discard, "", 0)),
+		NoSignals:  true,
+		ActionMap:  map[string]func(p *Pack){},
+	}
+	err := pack.RunE(nil)
+	notFound := &ActionNotFoundError{}
+	if assert.True(errors.As(err, &notFound)) {
+		assert.Equal("missing", notFound.Action)
+	}
+}
+
+func TestPackRunReport(t *testing.T) {
+	assert := assert.New(t)
+	const reportPath = "/tmp/test-pack-run-report.json"
+	defer os.Remove(reportPath)
+
+	rc := NewRunContext(log.New(ioutil.Discard, "", 0))
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{"password": "secret", "user": "app"},
+		Redact:     []string{"password"},
+		RunContext: rc,
+		ReportPath: reportPath,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				t1 := Task1{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t2 := Task2{Name: "task2", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t1.SetNotify(t2, action.Create, action.Create, true)
+				t1.Run(action.Create)
+			},
+		},
+	}
+	assert.NoError(pack.RunE(nil))
+
+	b, err := ioutil.ReadFile(reportPath)
+	assert.NoError(err)
+	report := RunReport{}
+	assert.NoError(json.Unmarshal(b, &report))
+
+	assert.Equal("pack1", report.Pack)
+	assert.Equal([]string{"default"}, report.Actions)
+	assert.Equal("***", (*report.Props)["password"])
+	assert.Equal("app", (*report.Props)["user"])
+	assert.Equal("ok", report.Outcome)
+	assert.Len(report.Tasks, 2)
+	assert.Equal(TaskResult{
+		Task:     "task1",
+		Action:   "create",
+		Depth:    1,
+		Status:   "has run",
+		Start:    report.Tasks[0].Start,
+		Duration: report.Tasks[0].Duration,
+	}, report.Tasks[0])
+	assert.Equal("task2", report.Tasks[1].Task)
+	assert.Len(report.Notifications, 1)
+	assert.Equal("task2", report.Notifications[0].Task)
+	assert.True(report.Notifications[0].Delayed)
+}
+
+func TestPackRunInterrupted(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	rc.SetContext(ctx)
+
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{},
+		RunContext: rc,
+		NoSignals:  true,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				t1 := Task1{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t2 := Task2{Name: "task2", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t1.SetNotify(t2, action.Create, action.Create, true)
+				t1.Run(action.Create)
+				cancel()
+				Task1{Name: "task3", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Create)
+				Task1{Name: "task4", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Create)
+			},
+		},
+	}
+	assert.Equal(ErrInterrupted, pack.RunE(nil))
+
+	assert.Regexp(`task1.*create.*\(has run\)`, buf.String())
+	assert.Regexp(`task3.*create.*\(skipped due to interrupt\)`, buf.String())
+	assert.NotRegexp(`task4`, buf.String())
+	assert.NotRegexp(`task2`, buf.String())
+	assert.Regexp(`delayed tasks not run due to interrupt`, buf.String())
+	assert.Regexp(`Pack: pack1 \(interrupted\)`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestRunContextRun(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{},
+		RunContext: rc,
+		NoSignals:  true,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				task := Task1{Name: "task1"}
+				assert.Equal(ActionRunStatus{action.Create: true}, p.RunContext.Run(task, action.Create))
+				assert.Nil(task.RunContext)
+				p.RunContext.Run(&Task1{Name: "task2"}, action.Create)
+				// a task's own run context is kept
+				other := NewRunContext(log.New(ioutil.Discard, "", 0))
+				p.RunContext.Run(Task1{Name: "task3", BaseTask: BaseTask{RunContext: other}}, action.Create)
+				assert.Len(other.TasksRun(), 1)
+				// a task run without a run context isn't part of the pack
+				Task1{Name: "task4"}.Run(action.Create)
+			},
+		},
+	}
+	assert.NoError(pack.RunE(nil))
+	assert.Regexp(`task1.*create.*\(has run\)`, buf.String())
+	assert.Regexp(`task2.*create.*\(has run\)`, buf.String())
+	assert.NotRegexp(`task3|task4`, buf.String())
+	assert.Len(rc.TasksRun(), 2)
+	// the default run context doesn't keep a summary
+	assert.Len(DefaultRunContext.TasksRun(), 0)
+
+	// a pack without a run context doesn't use the default run context
+	pack.RunContext = nil
+	assert.NoError(pack.RunE(nil))
+	assert.NotSame(DefaultRunContext, pack.RunContext)
+	assert.Len(pack.RunContext.TasksRun(), 2)
+	fmt.Print(buf.String())
+}
+
+func TestPackSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	source := Task1{Name: "task1"}
+	wired := Task1{Name: "task2", BaseTask: BaseTask{RunContext: rc}}
+	restart := Task2{Name: "task3 subscribed"}
+	reload := Task2{Name: "task4 subscribed"}
+	// subscriptions made before the pack runs are kept by the source tasks
+	restart.SetSubscribe(&restart, &source, action.Create, action.Create, true)
+	restart.SetSubscribe(&restart, &wired, action.Create, action.Create, true)
+	reload.SetSubscribe(&reload, &wired, action.Create, action.Create, false)
+
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{},
+		RunContext: rc,
+		NoSignals:  true,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				p.RunContext.Run(&source, action.Create)
+				wired.Run(action.Create)
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		assert.NoError(pack.RunE(nil))
+		assert.Regexp(fmt.Sprintf(`task4 subscribed.*create.*%s`, passKeywords), buf.String())
+		re := regexp.MustCompile(`task3 subscribed: create \(started\)`)
+		assert.Exactly(1, len(re.FindAllString(buf.String(), -1)), "task 3 notified more than once")
+	}
+	assert.Nil(source.RunContext)
+	fmt.Print(buf.String())
+}
+
+func TestPackCheck(t *testing.T) {
+	assert := assert.New(t)
+	const reportPath = "/tmp/test-pack-check-report.json"
+	defer os.Remove(reportPath)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{},
+		RunContext: rc,
+		Check:      true,
+		ReportPath: reportPath,
+		NoSignals:  true,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				Task2{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Nothing)
+				Task3{Name: "task2", BaseTask: BaseTask{RunContext: p.RunContext}, Func: func() (bool, error) {
+					b := BaseTask{RunContext: p.RunContext}
+					b.WouldChange(Drift{Resource: "/etc/foo", Attr: "mode", Have: "-rwxr-xr-x", Want: "-rw-------"}, "chmod %s", "/etc/foo")
+					return true, nil
+				}}.Run(action.Run)
+			},
+		},
+	}
+	assert.Equal(ErrDrift, pack.RunE(nil))
+	assert.True(rc.DryRun)
+	assert.Regexp(`\? would chmod /etc/foo`, buf.String())
+	assert.Regexp(`- mode -rwxr-xr-x`, buf.String())
+	assert.Regexp(`\+ mode -rw-------`, buf.String())
+	assert.Regexp(`Pack: pack1 \(drift\)`, buf.String())
+
+	b, err := ioutil.ReadFile(reportPath)
+	assert.NoError(err)
+	report := RunReport{}
+	assert.NoError(json.Unmarshal(b, &report))
+	assert.Equal("drift", report.Outcome)
+	assert.Equal([]Drift{{Resource: "/etc/foo", Attr: "mode", Have: "-rwxr-xr-x", Want: "-rw-------"}}, report.Drift)
+	fmt.Print(buf.String())
+
+	buf.Reset()
+	pack.ActionMap["default"] = func(p *Pack) {
+		Task2{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Nothing)
+	}
+	assert.NoError(pack.RunE(nil))
+	assert.Regexp(`Pack: pack1 \(end\)`, buf.String())
+
+	// changes without drift are unknown and don't fail the check
+	buf.Reset()
+	pack.ActionMap["default"] = func(p *Pack) {
+		Task3{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}, Func: func() (bool, error) {
+			BaseTask{RunContext: p.RunContext}.Would("run %s", "command")
+			return true, nil
+		}}.Run(action.Run)
+	}
+	assert.NoError(pack.RunE(nil))
+	assert.Regexp(`\? would run command \(unknown\)`, buf.String())
+	b, err = ioutil.ReadFile(reportPath)
+	assert.NoError(err)
+	report = RunReport{}
+	assert.NoError(json.Unmarshal(b, &report))
+	assert.Equal("ok", report.Outcome)
+	assert.Equal([]string{"run command"}, report.Unknown)
+	fmt.Print(buf.String())
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 
 	"github.com/mschenk42/gopack/color"
 )
 
 type Properties map[string]interface{}
 
+// propsLock guards the properties set while tasks run
+var propsLock sync.RWMutex
+
 func (p *Properties) String() string {
 	b, err := json.MarshalIndent(p, "", "  ")
 	if err != nil {
@@ -40,12 +44,26 @@ func (p *Properties) Merge(props *Properties) {
 }
 
 func (p *Properties) Exists(key string) bool {
-	_, x := (*p)[key]
+	_, x := p.get(key)
 	return x
 }
 
-func (p *Properties) Str(key string) string {
+// Set sets the property, it can be called by tasks run concurrently, e.g. by the tasks of a Graph
+func (p *Properties) Set(key string, v interface{}) {
+	propsLock.Lock()
+	defer propsLock.Unlock()
+	(*p)[key] = v
+}
+
+func (p *Properties) get(key string) (interface{}, bool) {
+	propsLock.RLock()
+	defer propsLock.RUnlock()
 	v, found := (*p)[key]
+	return v, found
+}
+
+func (p *Properties) Str(key string) string {
+	v, found := p.get(key)
 	if !found || v == nil {
 		return ""
 	}
@@ -54,7 +72,7 @@ func (p *Properties) Str(key string) string {
 }
 
 func (p *Properties) StrRequired(key string) string {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to string", key))
 	}
@@ -66,7 +84,7 @@ func (p *Properties) StrRequired(key string) string {
 }
 
 func (p *Properties) Float(key string) float64 {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		return 0
 	}
@@ -75,7 +93,7 @@ func (p *Properties) Float(key string) float64 {
 }
 
 func (p *Properties) FloatRequired(key string) float64 {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to float", key))
 	}
@@ -87,7 +105,7 @@ func (p *Properties) FloatRequired(key string) float64 {
 }
 
 func (p *Properties) Int(key string) int {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		return 0
 	}
@@ -96,7 +114,7 @@ func (p *Properties) Int(key string) int {
 }
 
 func (p *Properties) IntRequired(key string) int {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to int", key))
 	}
@@ -108,7 +126,7 @@ func (p *Properties) IntRequired(key string) int {
 }
 
 func (p *Properties) Map(key string) map[string]interface{} {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		return map[string]interface{}{}
 	}
@@ -117,7 +135,7 @@ func (p *Properties) Map(key string) map[string]interface{} {
 }
 
 func (p *Properties) MapRequired(key string) map[string]interface{} {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to map", key))
 	}
@@ -129,7 +147,7 @@ func (p *Properties) MapRequired(key string) map[string]interface{} {
 }
 
 func (p *Properties) Slice(key string) []interface{} {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		return []interface{}{}
 	}
@@ -138,7 +156,7 @@ func (p *Properties) Slice(key string) []interface{} {
 }
 
 func (p *Properties) SliceRequired(key string) []interface{} {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to slice", key))
 	}
@@ -150,7 +168,7 @@ func (p *Properties) SliceRequired(key string) []interface{} {
 }
 
 func (p *Properties) Bool(key string) bool {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		return false
 	}
@@ -159,7 +177,7 @@ func (p *Properties) Bool(key string) bool {
 }
 
 func (p *Properties) BoolRequired(key string) bool {
-	v, found := (*p)[key]
+	v, found := p.get(key)
 	if !found || v == nil {
 		panic(fmt.Sprintf("unable to convert %s to boolean", key))
 	}
@@ -0,0 +1,249 @@
+package gopack
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mschenk42/gopack/action"
+	"github.com/mschenk42/gopack/color"
+)
+
+// EventKind identifies what happened during a run
+type EventKind int
+
+const (
+	EventPackStart EventKind = iota
+	EventPackEnd
+	EventActionStart
+	EventActionEnd
+	EventTaskStart
+	EventTaskUpToDate
+	EventTaskChanged
+	EventTaskSkipped
+	EventTaskWould
+	EventTaskInfo
+	EventWarn
+	EventError
+	EventDelayedFlush
+	EventNotify
+	EventRetry
+)
+
+var eventKindNames = map[EventKind]string{
+	EventPackStart:    "pack_start",
+	EventPackEnd:      "pack_end",
+	EventActionStart:  "action_start",
+	EventActionEnd:    "action_end",
+	EventTaskStart:    "task_start",
+	EventTaskUpToDate: "task_up_to_date",
+	EventTaskChanged:  "task_changed",
+	EventTaskSkipped:  "task_skipped",
+	EventTaskWould:    "task_would",
+	EventTaskInfo:     "task_info",
+	EventWarn:         "warn",
+	EventError:        "error",
+	EventDelayedFlush: "delayed_flush",
+	EventNotify:       "notify",
+	EventRetry:        "retry",
+}
+
+func (k EventKind) String() string {
+	x, found := eventKindNames[k]
+	if !found {
+		x = fmt.Sprintf("Unknown event %d", k)
+	}
+	return x
+}
+
+// Event is sent to a Reporter for each step of a pack run.
+// Pack events carry the pack, task events carry the task and its actions.
+// Action events are for the pack's actions and carry the action name in Text.
+type Event struct {
+	Kind    EventKind
+	Time    time.Time
+	Pack    *Pack
+	Task    Task
+	Actions []action.Name
+	Reason  string
+	Text    string
+	Err     error
+	Elapsed time.Duration
+	Depth   int
+	DryRun  bool
+
+	// Props are the redacted pack properties, set for EventPackStart
+	Props *Properties
+	// Summary holds the changed top most tasks, set for EventPackEnd
+	Summary []Event
+	// Drift is how the resource a task would change differs, set for EventTaskWould
+	Drift *Drift
+}
+
+// Reporter receives the events of a run
+type Reporter interface {
+	Report(e Event)
+}
+
+// MultiReporter sends each event to all of its reporters
+type MultiReporter []Reporter
+
+// Report sends the event to each reporter
+func (m MultiReporter) Report(e Event) {
+	for _, r := range m {
+		r.Report(e)
+	}
+}
+
+// TextReporter logs events as colored text, this is the default reporter
+type TextReporter struct {
+	Log *log.Logger
+}
+
+var (
+	packHeaderFormat       = color.Blue("\nPack: %s (%s) %s")
+	packSectionFormat      = color.Blue("\n[%s %s]\n")
+	packErrorFormat        = color.Red("! %s\n")
+	packPropertyFormat     = color.Magenta("%s")
+	packActionHeaderFormat = color.Blue("Pack: %s %s (%s) %s")
+)
+
+var (
+	logStartFmt      = color.Cyan("%s%s: %s (%s)")
+	logErrHeaderFmt  = color.Red("%s%s: %s (%s) %s")
+	logWarnHeaderFmt = color.Yellow("%s%s: %s (%s) %s")
+	logRunFmt        = color.Cyan("%s%s: %s (%s) %s")
+	logErrFmt        = color.Red("%s! %s")
+	logWarnFmt       = color.Yellow("%s~ %s")
+	logWouldFmt      = color.Magenta("%s? would %s")
+	logUnknownFmt    = color.Magenta("%s? would %s (unknown)")
+	logDriftFmt      = color.Magenta("%s  %s %s %s")
+	logInfoFmt       = "%s%s"
+)
+
+// Report logs the event
+func (t TextReporter) Report(e Event) {
+	log := t.Log
+	if log == nil {
+		log = Log
+	}
+	indent := indent(e.Depth)
+
+	switch e.Kind {
+	case EventPackStart:
+		if e.DryRun {
+			log.Printf(packHeaderFormat, e.Pack, "start", "dry run")
+		} else {
+			log.Printf(packHeaderFormat, e.Pack, "start", "")
+		}
+		log.Printf(packPropertyFormat, e.Props)
+		log.Printf(packSectionFormat, "run actions for", e.Pack)
+	case EventPackEnd:
+		log.Printf(packSectionFormat, "summary of tasks run for", e.Pack)
+		for _, x := range e.Summary {
+			log.Printf(logRunFmt, "", x.Task, x.Actions[0], status(x), x.Elapsed)
+		}
+		if e.Err == ErrInterrupted {
+			log.Printf(packErrorFormat, e.Err)
+			log.Printf(packHeaderFormat, e.Pack, "interrupted", e.Elapsed)
+		} else if e.Err == ErrDrift {
+			log.Printf(packErrorFormat, e.Err)
+			log.Printf(packHeaderFormat, e.Pack, "drift", e.Elapsed)
+		} else if e.Err != nil {
+			log.Printf(packErrorFormat, e.Err)
+			log.Printf(packHeaderFormat, e.Pack, "failed", e.Elapsed)
+		} else {
+			log.Printf(packHeaderFormat, e.Pack, "end", e.Elapsed)
+		}
+		log.Print("")
+	case EventActionStart:
+		log.Printf(packActionHeaderFormat, e.Pack, e.Text, "start", "")
+	case EventActionEnd:
+		log.Printf(packActionHeaderFormat, e.Pack, e.Text, "end", e.Elapsed)
+	case EventDelayedFlush:
+		log.Printf(packSectionFormat, "run delayed tasks for", e.Pack)
+		if e.Reason != "" {
+			log.Printf(packErrorFormat, fmt.Sprintf("delayed tasks not run %s", e.Reason))
+		}
+	case EventTaskStart:
+		log.Printf(logStartFmt, indent, e.Task, e.Actions[0], "started")
+	case EventTaskUpToDate, EventTaskChanged:
+		log.Printf(logRunFmt, indent, e.Task, e.Actions[0], status(e), e.Elapsed)
+	case EventTaskSkipped:
+		log.Printf(logRunFmt, indent, e.Task, e.Actions, status(e), e.Elapsed)
+	case EventTaskWould:
+		if e.Drift == nil {
+			log.Printf(logUnknownFmt, indent, e.Text)
+			break
+		}
+		log.Printf(logWouldFmt, indent, e.Text)
+		log.Printf(logDriftFmt, indent, "-", e.Drift.Attr, e.Drift.Have)
+		log.Printf(logDriftFmt, indent, "+", e.Drift.Attr, e.Drift.Want)
+	case EventTaskInfo:
+		log.Printf(logInfoFmt, indent, e.Text)
+	case EventWarn:
+		log.Printf(logWarnHeaderFmt, indent, e.Task, e.Actions, "warn", e.Elapsed)
+		for _, s := range strings.Split(e.Err.Error(), "\n") {
+			log.Printf(logWarnFmt, indent, s)
+		}
+	case EventRetry:
+		log.Printf(logWarnFmt, indent, fmt.Sprintf("%s, %s", e.Text, e.Err))
+	case EventError:
+		log.Printf(logErrHeaderFmt, indent, e.Task, e.Actions, "error", e.Elapsed)
+		for _, s := range strings.Split(e.Err.Error(), "\n") {
+			log.Printf(logErrFmt, indent, s)
+		}
+	}
+
+	// separate the top most task actions
+	if e.Depth == 1 && (e.Kind == EventTaskUpToDate || e.Kind == EventTaskChanged || e.Kind == EventWarn) {
+		log.Println()
+	}
+}
+
+func status(e Event) string {
+	var s string
+	switch e.Kind {
+	case EventTaskStart:
+		return "started"
+	case EventWarn:
+		return "warn"
+	case EventRetry:
+		return "retry"
+	case EventError:
+		return "error"
+	case EventTaskUpToDate:
+		return "up to date"
+	case EventTaskSkipped:
+		return fmt.Sprintf("skipped %s", e.Reason)
+	case EventTaskChanged:
+		s = "has run"
+		if e.DryRun {
+			s = "would run"
+		}
+	}
+	if e.Reason != "" {
+		s = fmt.Sprintf("%s %s", s, e.Reason)
+	}
+	return s
+}
+
+func trimReason(status, reason string) string {
+	return strings.TrimSuffix(status, " "+reason)
+}
+
+func actionsString(actions []action.Name) string {
+	names := []string{}
+	for _, a := range actions {
+		names = append(names, a.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func indent(depth int) string {
+	if depth-1 <= 0 {
+		return ""
+	}
+	return strings.Repeat(" ", (depth-1)*2)
+}
@@ -0,0 +1,124 @@
+package gopack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// RunReport is the audit trail of a pack run which is saved to the pack's ReportPath
+type RunReport struct {
+	Pack          string         `json:"pack"`
+	Actions       []string       `json:"actions"`
+	Props         *Properties    `json:"props"`
+	DryRun        bool           `json:"dry_run"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Duration      float64        `json:"duration"`
+	Outcome       string         `json:"outcome"`
+	Error         string         `json:"error,omitempty"`
+	Tasks         []TaskResult   `json:"tasks"`
+	Notifications []Notification `json:"notifications"`
+	Drift         []Drift        `json:"drift"`
+	Unknown       []string       `json:"unknown"`
+}
+
+// TaskResult is the result of running a task's actions
+type TaskResult struct {
+	Task     string    `json:"task"`
+	Action   string    `json:"action"`
+	Depth    int       `json:"depth"`
+	Status   string    `json:"status"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+}
+
+// Notification is a task action which was notified to run
+type Notification struct {
+	Task    string    `json:"task"`
+	Action  string    `json:"action"`
+	Delayed bool      `json:"delayed"`
+	Time    time.Time `json:"time"`
+}
+
+// reportRecorder collects the task results and notifications of a run
+type reportRecorder struct {
+	report *RunReport
+}
+
+func newRunReport(p *Pack, props *Properties, dryRun bool, start time.Time) *RunReport {
+	actions := p.Actions
+	if len(actions) == 0 {
+		actions = []string{"default"}
+	}
+	return &RunReport{
+		Pack:          p.String(),
+		Actions:       actions,
+		Props:         props,
+		DryRun:        dryRun,
+		Start:         start,
+		Tasks:         []TaskResult{},
+		Notifications: []Notification{},
+		Drift:         []Drift{},
+		Unknown:       []string{},
+	}
+}
+
+func (r reportRecorder) Report(e Event) {
+	switch e.Kind {
+	case EventTaskUpToDate, EventTaskChanged, EventTaskSkipped, EventWarn, EventError:
+		x := TaskResult{
+			Task:     e.Task.String(),
+			Action:   actionsString(e.Actions),
+			Depth:    e.Depth,
+			Status:   trimReason(status(e), e.Reason),
+			Reason:   e.Reason,
+			Start:    e.Time.Add(-e.Elapsed),
+			Duration: e.Elapsed.Seconds(),
+		}
+		if e.Err != nil {
+			x.Error = e.Err.Error()
+		}
+		r.report.Tasks = append(r.report.Tasks, x)
+	case EventTaskWould:
+		if e.Drift != nil {
+			r.report.Drift = append(r.report.Drift, *e.Drift)
+		} else {
+			r.report.Unknown = append(r.report.Unknown, e.Text)
+		}
+	case EventNotify:
+		r.report.Notifications = append(r.report.Notifications, Notification{
+			Task:    e.Task.String(),
+			Action:  actionsString(e.Actions),
+			Delayed: e.Reason == "delayed",
+			Time:    e.Time,
+		})
+	}
+}
+
+// Save writes the report as indented JSON to path
+func (r *RunReport) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func (r *RunReport) finish(end time.Time, err error) {
+	r.End = end
+	r.Duration = end.Sub(r.Start).Seconds()
+	r.Outcome = "ok"
+	if err != nil {
+		r.Outcome = "failed"
+		r.Error = err.Error()
+	}
+	if err == ErrInterrupted {
+		r.Outcome = "interrupted"
+	}
+	if err == ErrDrift {
+		r.Outcome = "drift"
+	}
+}
@@ -0,0 +1,141 @@
+package gopack
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONReporter writes each event as a JSON object on its own line,
+// a summary object with the counts of tasks is written after the pack ends
+type JSONReporter struct {
+	W io.Writer
+
+	changed int
+	skipped int
+	warned  int
+	failed  int
+}
+
+type jsonEvent struct {
+	Kind     string      `json:"kind"`
+	Time     time.Time   `json:"time"`
+	Pack     string      `json:"pack,omitempty"`
+	Task     string      `json:"task,omitempty"`
+	Action   string      `json:"action,omitempty"`
+	Status   string      `json:"status,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Text     string      `json:"text,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Duration float64     `json:"duration"`
+	Depth    int         `json:"depth"`
+	DryRun   bool        `json:"dry_run,omitempty"`
+	Props    *Properties `json:"props,omitempty"`
+	Drift    *Drift      `json:"drift,omitempty"`
+}
+
+type jsonSummary struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	Pack     string    `json:"pack"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Changed  int       `json:"changed"`
+	Skipped  int       `json:"skipped"`
+	Warned   int       `json:"warned"`
+	Failed   int       `json:"failed"`
+	Duration float64   `json:"duration"`
+}
+
+// NewJSONReporter returns a reporter which writes JSON lines to w
+func NewJSONReporter(w io.Writer) *JSONReporter {
+	return &JSONReporter{W: w}
+}
+
+// Report writes the event as a JSON line
+func (j *JSONReporter) Report(e Event) {
+	x := jsonEvent{
+		Kind:     e.Kind.String(),
+		Time:     e.Time,
+		Reason:   e.Reason,
+		Text:     e.Text,
+		Duration: e.Elapsed.Seconds(),
+		Depth:    e.Depth,
+		DryRun:   e.DryRun,
+		Props:    e.Props,
+		Drift:    e.Drift,
+	}
+	if e.Pack != nil {
+		x.Pack = e.Pack.String()
+	}
+	if e.Task != nil {
+		x.Task = e.Task.String()
+	}
+	if e.Err != nil {
+		x.Error = e.Err.Error()
+	}
+
+	switch e.Kind {
+	case EventActionStart, EventActionEnd:
+		x.Action = e.Text
+		x.Text = ""
+	case EventTaskStart, EventTaskUpToDate, EventTaskChanged, EventTaskSkipped, EventWarn, EventRetry, EventError:
+		x.Status = trimReason(status(e), e.Reason)
+	}
+	if len(e.Actions) > 0 {
+		x.Action = actionsString(e.Actions)
+	}
+	j.count(e)
+	j.write(x)
+
+	if e.Kind == EventPackEnd {
+		s := jsonSummary{
+			Kind:     "summary",
+			Time:     e.Time,
+			Pack:     x.Pack,
+			Status:   "ok",
+			Changed:  j.changed,
+			Skipped:  j.skipped,
+			Warned:   j.warned,
+			Failed:   j.failed,
+			Duration: e.Elapsed.Seconds(),
+		}
+		if e.Err != nil {
+			s.Status = "failed"
+			s.Error = e.Err.Error()
+		}
+		if e.Err == ErrInterrupted {
+			s.Status = "interrupted"
+		}
+		if e.Err == ErrDrift {
+			s.Status = "drift"
+		}
+		j.write(s)
+		j.changed, j.skipped, j.warned, j.failed = 0, 0, 0, 0
+	}
+}
+
+func (j *JSONReporter) count(e Event) {
+	// nested tasks are part of the top most task
+	if e.Depth != 1 {
+		return
+	}
+	switch e.Kind {
+	case EventTaskChanged:
+		j.changed++
+	case EventTaskSkipped:
+		j.skipped++
+	case EventWarn:
+		j.warned++
+	case EventError:
+		j.failed++
+	}
+}
+
+func (j *JSONReporter) write(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(jsonEvent{Kind: "error", Time: time.Now(), Error: err.Error()})
+	}
+	j.W.Write(append(b, '\n'))
+}
@@ -0,0 +1,133 @@
+package gopack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordReporter struct {
+	events []Event
+}
+
+func (r *recordReporter) Report(e Event) {
+	r.events = append(r.events, e)
+}
+
+func (r *recordReporter) kinds() []EventKind {
+	kinds := []EventKind{}
+	for _, e := range r.events {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestReporterEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	reporter := &recordReporter{}
+	rc := NewRunContext(nil)
+	rc.Reporter = reporter
+
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{"password": "secret"},
+		Redact:     []string{"password"},
+		RunContext: rc,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				t1 := Task1{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t2 := Task2{Name: "task2", BaseTask: BaseTask{RunContext: p.RunContext}}
+				t1.SetNotify(t2, action.Create, action.Create, true)
+				t1.Run(action.Create)
+				Task2{
+					Name: "task3",
+					BaseTask: BaseTask{
+						RunContext: p.RunContext,
+						NotIf:      func() (bool, error) { return true, nil }},
+				}.Run(action.Create)
+				Task2{Name: "task4", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Nothing)
+			},
+		},
+	}
+	assert.NoError(pack.RunE(nil))
+
+	assert.Equal([]EventKind{
+		EventPackStart,
+		EventTaskStart, EventTaskChanged,
+		EventTaskSkipped,
+		EventTaskStart, EventTaskUpToDate,
+		EventDelayedFlush,
+		EventNotify, EventTaskStart, EventTaskChanged,
+		EventPackEnd,
+	}, reporter.kinds())
+
+	assert.Equal("***", (*reporter.events[0].Props)["password"])
+	assert.Equal("due to not_if", reporter.events[3].Reason)
+	assert.Equal(1, reporter.events[1].Depth)
+	end := reporter.events[len(reporter.events)-1]
+	assert.NoError(end.Err)
+	assert.Len(end.Summary, 2)
+	assert.Equal("task1", end.Summary[0].Task.String())
+	assert.Equal("task2", end.Summary[1].Task.String())
+}
+
+func TestJSONReporter(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(nil)
+	rc.Reporter = NewJSONReporter(buf)
+
+	pack := Pack{
+		Name:       "pack1",
+		Props:      &Properties{"password": "secret"},
+		Redact:     []string{"password"},
+		RunContext: rc,
+		ActionMap: map[string]func(p *Pack){
+			"default": func(p *Pack) {
+				Task1{Name: "task1", BaseTask: BaseTask{RunContext: p.RunContext}}.Run(action.Create)
+				Task1{
+					Name: "task2",
+					BaseTask: BaseTask{
+						RunContext: p.RunContext,
+						OnlyIf:     func() (bool, error) { return false, nil }},
+				}.Run(action.Create)
+			},
+		},
+	}
+	assert.NoError(pack.RunE(nil))
+
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		m := map[string]interface{}{}
+		assert.NoError(json.Unmarshal(scanner.Bytes(), &m))
+		lines = append(lines, m)
+	}
+	assert.Len(lines, 7)
+
+	assert.Equal("pack_start", lines[0]["kind"])
+	assert.Equal(map[string]interface{}{"password": "***"}, lines[0]["props"])
+
+	assert.Equal("task_changed", lines[2]["kind"])
+	assert.Equal("task1", lines[2]["task"])
+	assert.Equal("create", lines[2]["action"])
+	assert.Equal("has run", lines[2]["status"])
+	assert.Equal(float64(1), lines[2]["depth"])
+
+	assert.Equal("task_skipped", lines[3]["kind"])
+	assert.Equal("skipped", lines[3]["status"])
+	assert.Equal("due to only_if", lines[3]["reason"])
+
+	summary := lines[len(lines)-1]
+	assert.Equal("summary", summary["kind"])
+	assert.Equal("ok", summary["status"])
+	assert.Equal(float64(1), summary["changed"])
+	assert.Equal(float64(1), summary["skipped"])
+	assert.Equal(float64(0), summary["failed"])
+}
@@ -1,49 +1,57 @@
 package gopack
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"strings"
 	"time"
 
 	"github.com/mschenk42/gopack/action"
-	"github.com/mschenk42/gopack/color"
-)
-
-var (
-	delayedNotify taskRunSet = taskRunSet{}
-	tasksRun      []string   = []string{}
-	indentLevel   int
 )
 
 type BaseTask struct {
 	OnlyIf      guardFunc
 	NotIf       guardFunc
 	ContOnError bool
+	RunContext  *RunContext
+
+	// Tags select the task when the run has tags, the tags also select the tasks it runs
+	Tags []string
+
+	// Retries is the number of times a failed action is retried, waiting RetryDelay
+	// before the first retry, the delay is multiplied by RetryBackoff after each retry
+	Retries      int
+	RetryDelay   time.Duration
+	RetryBackoff float64
 
+	onlyIf []Guard
+	notIf  []Guard
 	notify actionTaskRunSet
+	id     *taskIdentity
 }
 
 type ActionRunStatus map[action.Name]bool
 
-type guardFunc func() (bool, error)
-type actionTaskRunSet map[action.Name]map[string]func()
-type taskRunSet map[string]func()
+// TaskError is raised when a task action fails and ContOnError is false
+type TaskError struct {
+	Task    Task
+	Actions []action.Name
+	Elapsed time.Duration
+	Err     error
+}
 
-func (d *taskRunSet) Run() {
-	// running task funcs can result in new map entries
-	for len(*d) > 0 {
-		for k, f := range *d {
-			f()
-			// per Go spec it's safe to delete while ranging over
-			delete(*d, k)
-		}
-	}
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%s: %s failed after %s, %s", e.Task, e.Actions, e.Elapsed, e.Err)
+}
+
+// Unwrap returns the error which caused the task to fail
+func (e *TaskError) Unwrap() error {
+	return e.Err
 }
 
+type guardFunc func() (bool, error)
+type actionTaskRunSet map[action.Name]map[string]func(rc *RunContext)
+type taskRunSet map[string]func()
+
 type Runner interface {
 	Run(actions ...action.Name) ActionRunStatus
 }
@@ -53,6 +61,28 @@ type Task interface {
 	fmt.Stringer
 }
 
+// RunE runs the task's actions and returns the task error instead of stopping the pack
+func RunE(task Runner, actions ...action.Name) (runStatus ActionRunStatus, err error) {
+	defer recoverTaskError(&err)
+	return task.Run(actions...), nil
+}
+
+func recoverTaskError(err *error) {
+	if r := recover(); r != nil {
+		te, ok := r.(*TaskError)
+		if !ok {
+			panic(r)
+		}
+		*err = te
+	}
+}
+
+func runAction(f action.Func) (hasRun bool, err error) {
+	// errors from tasks run by the action are returned as the action's error
+	defer recoverTaskError(&err)
+	return f()
+}
+
 func (b BaseTask) RunActions(task Task, regActions action.Funcs, runActions []action.Name) ActionRunStatus {
 	var (
 		f         action.Func
@@ -62,14 +92,19 @@ func (b BaseTask) RunActions(task Task, regActions action.Funcs, runActions []ac
 		reason    string
 		runStatus ActionRunStatus = ActionRunStatus{}
 		timeStart time.Time       = time.Now()
+		rc        *RunContext     = b.Ctx()
 	)
 
-	indentLevel += 1
+	defer rc.enter()()
+
+	if rc.Interrupted() {
+		b.logSkipped(task, runActions, "due to interrupt", timeStart)
+		panic(&TaskError{Task: task, Actions: runActions, Elapsed: time.Since(timeStart), Err: ErrInterrupted})
+	}
 
 	// if there are more than one registered actions and no run action given
 	if len(runActions) == 0 && len(regActions) != 1 {
 		b.logError(task, action.NewSlice(action.Nil), fmt.Errorf("unable to run, no action given"), timeStart)
-		indentLevel -= 1
 		return runStatus
 	}
 
@@ -80,9 +115,15 @@ func (b BaseTask) RunActions(task Task, regActions action.Funcs, runActions []ac
 		}
 	}
 
+	selected, restoreTagged := rc.selectTags(b.Tags)
+	defer restoreTagged()
+	if !selected {
+		b.logSkipped(task, runActions, "due to tags", timeStart)
+		return runStatus
+	}
+
 	if canRun, reason = b.canRun(task, runActions, timeStart); !canRun {
 		b.logSkipped(task, runActions, reason, timeStart)
-		indentLevel -= 1
 		return runStatus
 	}
 
@@ -93,132 +134,120 @@ func (b BaseTask) RunActions(task Task, regActions action.Funcs, runActions []ac
 			continue
 		}
 		b.logStart(task, a)
-		if runStatus[a], err = f(); err == nil {
+		if runStatus[a], err = b.runActionRetries(task, a, f); err == nil {
 			b.logRun(task, a, runStatus[a], reason, timeStart)
 			if runStatus[a] {
-				b.notifyTasks(a)
+				b.notifyTasks(task, a)
 			}
 		} else {
 			b.logError(task, action.NewSlice(a), err, timeStart)
 		}
-		if indentLevel == 1 {
-			Log.Println()
-		}
 	}
-	indentLevel -= 1
 	return runStatus
 }
 
-func (b *BaseTask) SetNotify(notify Task, forAction, whenAction action.Name, delayed bool) {
-	if b.notify == nil {
-		b.notify = actionTaskRunSet{}
-	}
-	if b.notify[whenAction] == nil {
-		b.notify[whenAction] = map[string]func(){}
-	}
-	if delayed {
-		b.notify[whenAction][fmt.Sprintf("%s:%s", notify, forAction)] = func() {
-			delayedNotify[fmt.Sprintf("%s:%s", notify, forAction)] = func() { notify.Run(forAction) }
+func (b BaseTask) runActionRetries(task Task, a action.Name, f action.Func) (bool, error) {
+	rc := b.Ctx()
+	delay := b.RetryDelay
+	for attempt := 1; ; attempt++ {
+		hasRun, err := runAction(f)
+		if err == nil || attempt > b.Retries || rc.Interrupted() {
+			return hasRun, err
 		}
-	} else {
-		b.notify[whenAction][fmt.Sprintf("%s:%s", notify, forAction)] = func() {
-			notify.Run(forAction)
+		rc.Report(Event{
+			Kind:    EventRetry,
+			Task:    task,
+			Actions: action.NewSlice(a),
+			Err:     err,
+			Text:    fmt.Sprintf("attempt %d of %d failed, retrying in %s", attempt, b.Retries+1, delay),
+		})
+		select {
+		case <-time.After(delay):
+		case <-rc.Context().Done():
+			return hasRun, err
+		}
+		if b.RetryBackoff > 1 {
+			delay = time.Duration(float64(delay) * b.RetryBackoff)
 		}
 	}
 }
 
-func (b *BaseTask) SetOnlyIf(f guardFunc) {
-	b.OnlyIf = f
-}
-
-func (b *BaseTask) SetNotIf(f guardFunc) {
-	b.NotIf = f
-}
-
-func (b BaseTask) notifyTasks(action action.Name) {
-	funcs, found := b.notify[action]
-	if found {
-		for _, f := range funcs {
-			f()
-		}
+// Ctx returns the task's run context, DefaultRunContext is returned if the task has none
+func (b BaseTask) Ctx() *RunContext {
+	if b.RunContext != nil {
+		return b.RunContext
 	}
+	return DefaultRunContext
 }
 
-func (b BaseTask) canRun(task Task, a []action.Name, t time.Time) (bool, string) {
-	var (
-		err    error
-		run    bool = true
-		reason string
-	)
-	if b.OnlyIf != nil {
-		reason = "due to only_if"
-		run, err = b.OnlyIf()
-		b.logError(task, a, err, t)
-	}
-	if b.NotIf != nil {
-		reason = "due to not_if"
-		run, err = b.NotIf()
-		run = !run
-		b.logError(task, a, err, t)
-	}
-	return run, reason
+// DryRun returns true when tasks should only report the changes they would make
+func (b BaseTask) DryRun() bool {
+	return b.Ctx().DryRun
 }
 
-var (
-	logStartFmt      = color.Cyan("%s%s: %s (%s)")
-	logErrHeaderFmt  = color.Red("%s%s: %s (%s) %s")
-	logWarnHeaderFmt = color.Yellow("%s%s: %s (%s) %s")
-	logRunFmt        = color.Cyan("%s%s: %s (%s) %s")
-	logErrFmt        = color.Red("%s! %s")
-	logWarnFmt       = color.Yellow("%s~ %s")
-	logInfoFmt       = "%s%s"
-)
+// Would logs a change the task would have made if it were not a dry run
+func (b BaseTask) Would(format string, a ...interface{}) {
+	b.Ctx().Report(Event{Kind: EventTaskWould, Text: fmt.Sprintf(format, a...)})
+}
 
-func logIndent() string {
-	if indentLevel-1 <= 0 {
-		return ""
-	}
-	return strings.Repeat(" ", (indentLevel-1)*2)
+// WouldChange logs a change the task would have made with the drift of the resource it would change
+func (b BaseTask) WouldChange(d Drift, format string, a ...interface{}) {
+	b.Ctx().Report(Event{Kind: EventTaskWould, Text: fmt.Sprintf(format, a...), Drift: &d})
 }
 
-func NewTaskInfoWriter() io.Writer {
-	return taskInfoWriter{}
+func (b *BaseTask) SetOnlyIf(f guardFunc) {
+	b.OnlyIf = f
 }
 
-type taskInfoWriter struct {
+func (b *BaseTask) SetNotIf(f guardFunc) {
+	b.NotIf = f
 }
 
-func (t taskInfoWriter) Write(b []byte) (int, error) {
-	buf := bytes.NewBuffer(b)
-	scanner := bufio.NewScanner(buf)
-	for scanner.Scan() {
-		Log.Printf(logInfoFmt, logIndent(), scanner.Text())
+// canRun evaluates the only_if guards then the not_if guards until one decides the task is not run,
+// the reason is for the guard which decided or the last guard evaluated. A guard error stops the task,
+// or if ContOnError is set it's logged as a warning and the task is skipped.
+func (b BaseTask) canRun(task Task, a []action.Name, t time.Time) (bool, string) {
+	var reason string
+	for _, g := range b.onlyIfGuards() {
+		reason = g.reason("only_if")
+		ok, err := g.Cond()
+		if err != nil {
+			b.logError(task, a, err, t)
+			return false, reason + " error"
+		}
+		if !ok {
+			return false, reason
+		}
+	}
+	for _, g := range b.notIfGuards() {
+		reason = g.reason("not_if")
+		ok, err := g.Cond()
+		if err != nil {
+			b.logError(task, a, err, t)
+			return false, reason + " error"
+		}
+		if ok {
+			return false, reason
+		}
 	}
-	return len(b), nil
+	return true, reason
 }
 
 func (b BaseTask) logStart(task Task, a action.Name) {
-	Log.Printf(logStartFmt, logIndent(), task, a, "started")
+	b.Ctx().Report(Event{Kind: EventTaskStart, Task: task, Actions: action.NewSlice(a)})
 }
 
 func (b BaseTask) logRun(task Task, a action.Name, hasRun bool, reason string, t time.Time) {
-	s := fmt.Sprintf(logRunFmt, logIndent(), task, a, "up to date", time.Since(t))
+	e := Event{Kind: EventTaskUpToDate, Task: task, Actions: action.NewSlice(a), Elapsed: time.Since(t)}
 	if hasRun {
-		status := "has run"
-		if reason != "" {
-			status = fmt.Sprintf("%s %s", status, reason)
-		}
-		s = fmt.Sprintf(logRunFmt, logIndent(), task, a, status, time.Since(t))
-		// let's just track the top most tasks
-		if indentLevel == 1 {
-			tasksRun = append(tasksRun, fmt.Sprintf(logRunFmt, "", task, a, status, time.Since(t)))
-		}
+		e.Kind = EventTaskChanged
+		e.Reason = reason
 	}
-	Log.Printf(s)
+	b.Ctx().Report(e)
 }
 
 func (b BaseTask) logSkipped(task Task, a []action.Name, reason string, t time.Time) {
-	Log.Printf(logRunFmt, logIndent(), task, a, fmt.Sprintf("skipped %s", reason), time.Since(t))
+	b.Ctx().Report(Event{Kind: EventTaskSkipped, Task: task, Actions: a, Reason: reason, Elapsed: time.Since(t)})
 }
 
 func (b BaseTask) logError(task Task, a []action.Name, err error, t time.Time) {
@@ -226,13 +255,9 @@ func (b BaseTask) logError(task Task, a []action.Name, err error, t time.Time) {
 		return
 	}
 	if b.ContOnError {
-		Log.Printf(logWarnHeaderFmt, logIndent(), task, a, "warn", time.Since(t))
-		lines := strings.Split(err.Error(), "\n")
-		for _, s := range lines {
-			Log.Printf(logWarnFmt, logIndent(), s)
-		}
+		b.Ctx().Report(Event{Kind: EventWarn, Task: task, Actions: a, Err: err, Elapsed: time.Since(t)})
 	} else {
-		Log.Printf(logErrHeaderFmt, logIndent(), task, a, "error", time.Since(t))
-		Log.Panicf(logErrFmt, logIndent(), err)
+		b.Ctx().Report(Event{Kind: EventError, Task: task, Actions: a, Err: err, Elapsed: time.Since(t)})
+		panic(&TaskError{Task: task, Actions: a, Elapsed: time.Since(t), Err: err})
 	}
 }
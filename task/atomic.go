@@ -0,0 +1,175 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mschenk42/gopack"
+)
+
+// verifyTimeout is how long a verify command has to check a temp file
+const verifyTimeout = 5 * time.Minute
+
+// AtomicFile is a temp file in the directory of Path which replaces Path when it's committed,
+// Path is left untouched until then. If Path is a symlink the file it links to is replaced.
+type AtomicFile struct {
+	*os.File
+	Path string
+	Perm os.FileMode
+}
+
+// NewAtomicFile creates the temp file for path. If perm is 0 the mode of the existing file is kept.
+func NewAtomicFile(path string, perm os.FileMode) (*AtomicFile, error) {
+	path, err := resolveLinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if perm == 0 {
+		if fi, err := os.Stat(path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: f, Path: path, Perm: perm}, nil
+}
+
+// Commit syncs the temp file, sets its mode and ownership and renames it to Path.
+// If neither owner nor group is given the ownership of the existing file is kept.
+func (f *AtomicFile) Commit(owner, group string) error {
+	err := f.commit(owner, group)
+	if err != nil {
+		f.Abort()
+	}
+	return err
+}
+
+func (f *AtomicFile) commit(owner, group string) error {
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), f.Perm); err != nil {
+		return err
+	}
+	if owner != "" || group != "" {
+		uid, gid, err := lookupIds(owner, group)
+		if err != nil {
+			return err
+		}
+		if err = os.Chown(f.Name(), uid, gid); err != nil {
+			return err
+		}
+	} else if err := keepOwnership(f.Path, f.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), f.Path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(f.Path))
+}
+
+// Verify runs the verify command line with sh -c, %{path} is replaced by the path of the temp file.
+// The command's output is logged to rc, an error is returned if it exits with non zero.
+func (f *AtomicFile) Verify(rc *gopack.RunContext, verify string) error {
+	if verify == "" {
+		return nil
+	}
+	quoted := "'" + strings.Replace(f.Name(), "'", `'\''`, -1) + "'"
+	b, err := execCmd(rc.Context(), verifyTimeout, "sh", nil, "", "-c", strings.Replace(verify, "%{path}", quoted, -1))
+	if len(b) > 0 {
+		rc.NewTaskInfoWriter().Write(b)
+	}
+	if err != nil {
+		return fmt.Errorf("verify `%s` failed for %s, %s", verify, f.Path, err)
+	}
+	return nil
+}
+
+// Abort closes and removes the temp file
+func (f *AtomicFile) Abort() error {
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// keepOwnership gives the temp file the owner and group of the file at path if it exists
+func keepOwnership(path, temp string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ti, err := os.Stat(temp)
+	if err != nil {
+		return err
+	}
+	have, ok := ti.Sys().(*syscall.Stat_t)
+	want, wok := fi.Sys().(*syscall.Stat_t)
+	if !ok || !wok || (have.Uid == want.Uid && have.Gid == want.Gid) {
+		return nil
+	}
+	if err = os.Chown(temp, int(want.Uid), int(want.Gid)); err != nil {
+		return fmt.Errorf("unable to keep the ownership of %s, %s", path, err)
+	}
+	return nil
+}
+
+// resolveLinks follows the symlinks at path and returns the path they link to, the path linked to
+// doesn't have to exist
+func resolveLinks(path string) (string, error) {
+	for i := 0; i < 255; i++ {
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("too many links at %s", path)
+}
+
+// WriteFileAtomic writes data to a temp file which replaces path, see AtomicFile
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, owner, group string) error {
+	f, err := NewAtomicFile(path, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit(owner, group)
+}
+
+// syncDir makes the rename of a file in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-atomic"
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := filepath.Join(testDir, "app.conf")
+
+	assert.NoError(WriteFileAtomic(path, []byte("v1\n"), 0640, "", ""))
+	fi, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0640), fi.Mode().Perm())
+
+	// the mode of the existing file is kept if no perm is given
+	assert.NoError(WriteFileAtomic(path, []byte("v2\n"), 0, "", ""))
+	fi, _ = os.Stat(path)
+	assert.Equal(os.FileMode(0640), fi.Mode().Perm())
+
+	f, err := NewAtomicFile(path, 0644)
+	assert.NoError(err)
+	f.Write([]byte("partial"))
+	assert.NoError(f.Abort())
+
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("v2\n", string(b))
+	infos, _ := ioutil.ReadDir(testDir)
+	assert.Len(infos, 1, "temp files should be removed")
+}
+
+func TestWriteFileAtomicOwnership(t *testing.T) {
+	assert := assert.New(t)
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of a file requires root")
+	}
+	const testDir = "/tmp/test-atomic-owner"
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := filepath.Join(testDir, "app.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte("v1\n"), 0644))
+	assert.NoError(os.Chown(path, 1, 1))
+
+	// the owner of the file is kept if no owner or group is given
+	assert.NoError(WriteFileAtomic(path, []byte("v2\n"), 0, "", ""))
+	fi, err := os.Stat(path)
+	assert.NoError(err)
+	st := fi.Sys().(*syscall.Stat_t)
+	assert.Equal(uint32(1), st.Uid)
+	assert.Equal(uint32(1), st.Gid)
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-atomic-symlink"
+
+	assert.NoError(os.MkdirAll(filepath.Join(testDir, "run"), 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	target := filepath.Join(testDir, "run", "resolv.conf")
+	link := filepath.Join(testDir, "resolv.conf")
+	assert.NoError(os.Symlink("run/resolv.conf", link))
+
+	// the file linked to is created and replaced, the link is kept
+	for _, data := range []string{"v1\n", "v2\n"} {
+		assert.NoError(WriteFileAtomic(link, []byte(data), 0644, "", ""))
+		fi, err := os.Lstat(link)
+		assert.NoError(err)
+		assert.True(fi.Mode()&os.ModeSymlink != 0)
+		b, _ := ioutil.ReadFile(target)
+		assert.Equal(data, string(b))
+	}
+}
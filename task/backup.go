@@ -0,0 +1,163 @@
+package task
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mschenk42/gopack"
+)
+
+const (
+	backupTimeFormat = "20060102T150405.000000000"
+	backupSuffix     = ".bak"
+)
+
+// Backup keeps timestamped copies of a file before a task overwrites it. Keep is the number of
+// copies kept, no copies are made if it's 0. The copies are kept in Dir or next to the file if Dir is empty,
+// the copies kept in Dir are named by the escaped path of the file so files with the same name can share Dir.
+type Backup struct {
+	Keep int
+	Dir  string
+}
+
+// Save copies the file at path to a new backup and prunes the oldest backups,
+// the path of the backup is returned, an empty string is returned if no backup was made
+func (b Backup) Save(path string) (string, error) {
+	if b.Keep <= 0 {
+		return "", nil
+	}
+	fi, exists, err := Fexists(path)
+	if err != nil || !exists {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	dir := b.dir(path)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	prefix, err := b.prefix(path)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s%s%s", prefix, time.Now().UTC().Format(backupTimeFormat), backupSuffix)
+	backup := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(backup, data, fi.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return backup, b.prune(path)
+}
+
+// List returns the paths of the backups of the file at path, oldest first
+func (b Backup) List(path string) ([]string, error) {
+	prefix, err := b.prefix(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := b.dir(path)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := []string{}
+	for _, fi := range infos {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), backupSuffix)
+		if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	// the timestamps sort in time order
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Restore copies the named backup of the file at path back to path, name is the file name of a backup from List.
+// The file is replaced atomically keeping its mode and ownership, the backup's mode is used if the file doesn't exist.
+func (b Backup) Restore(path, name string) error {
+	backups, err := b.List(path)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if filepath.Base(backup) != filepath.Base(name) {
+			continue
+		}
+		data, err := ioutil.ReadFile(backup)
+		if err != nil {
+			return err
+		}
+		var perm os.FileMode
+		if _, exists, err := Fexists(path); err != nil {
+			return err
+		} else if !exists {
+			fi, err := os.Stat(backup)
+			if err != nil {
+				return err
+			}
+			perm = fi.Mode().Perm()
+		}
+		return WriteFileAtomic(path, data, perm, "", "")
+	}
+	return fmt.Errorf("backup %s of %s not found", name, path)
+}
+
+// BackupFile saves a backup of the file at path before a task overwrites it, the backup is logged to rc
+func BackupFile(rc *gopack.RunContext, b Backup, path string) error {
+	backup, err := b.Save(path)
+	if err != nil {
+		return fmt.Errorf("unable to backup %s, %s", path, err)
+	}
+	if backup != "" {
+		fmt.Fprintf(rc.NewTaskInfoWriter(), "backup %s\n", backup)
+	}
+	return nil
+}
+
+func (b Backup) prune(path string) error {
+	backups, err := b.List(path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > b.Keep {
+		if err = os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// prefix returns the start of the names of the backups of the file at path
+func (b Backup) prefix(path string) (string, error) {
+	if b.Dir == "" {
+		return filepath.Base(path) + ".", nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return url.PathEscape(abs) + ".", nil
+}
+
+func (b Backup) dir(path string) string {
+	if b.Dir != "" {
+		return b.Dir
+	}
+	return filepath.Dir(path)
+}
@@ -0,0 +1,96 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mschenk42/gopack"
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-backup"
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := filepath.Join(testDir, "app.conf")
+
+	b := Backup{Keep: 2, Dir: filepath.Join(testDir, "backups")}
+	backup, err := b.Save(path)
+	assert.NoError(err)
+	assert.Empty(backup)
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(ioutil.WriteFile(path, []byte(fmt.Sprintf("version %d\n", i)), 0644))
+		_, err = b.Save(path)
+		assert.NoError(err)
+	}
+	backups, err := b.List(path)
+	assert.NoError(err)
+	assert.Len(backups, 2)
+
+	assert.NoError(os.Chmod(path, 0600))
+	assert.NoError(b.Restore(path, filepath.Base(backups[0])))
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("version 2\n", string(data))
+	fi, _ := os.Stat(path)
+	assert.Equal(os.FileMode(0600), fi.Mode().Perm(), "the mode of the restored file should be kept")
+	assert.Error(b.Restore(path, "app.conf.20000101T000000.000000000.bak"))
+
+	backups, err = Backup{}.List(path)
+	assert.NoError(err)
+	assert.Empty(backups)
+
+	// a file with the same name in another directory doesn't share the backups
+	other := filepath.Join(testDir, "other", "app.conf")
+	assert.NoError(os.MkdirAll(filepath.Dir(other), 0755))
+	assert.NoError(ioutil.WriteFile(other, []byte("other\n"), 0644))
+	for i := 0; i < 3; i++ {
+		_, err = b.Save(other)
+		assert.NoError(err)
+	}
+	backups, err = b.List(path)
+	assert.NoError(err)
+	assert.Len(backups, 2)
+	assert.Contains(filepath.Base(backups[0]), "%2Ftmp%2Ftest-backup%2Fapp.conf.")
+	backups, err = b.List(other)
+	assert.NoError(err)
+	assert.Len(backups, 2)
+}
+
+func TestTemplateBackup(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-backup-template"
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := filepath.Join(testDir, "app.conf")
+	assert.NoError(ioutil.WriteFile(path, []byte("old\n"), 0755))
+
+	Template{
+		Name:   "app",
+		Path:   path,
+		Source: "new\n",
+		Backup: Backup{Keep: 1},
+	}.Run(action.Create)
+
+	backups, err := Backup{}.List(path)
+	assert.NoError(err)
+	assert.Len(backups, 1)
+	data, _ := ioutil.ReadFile(backups[0])
+	assert.Equal("old\n", string(data))
+	assert.Regexp(`backup /tmp/test-backup-template/app.conf.*\.bak`, buf.String())
+	fmt.Print(buf.String())
+}
@@ -1,10 +1,20 @@
 package task
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/mschenk42/gopack"
@@ -21,12 +31,49 @@ type Command struct {
 	Sensitive bool
 	Timeout   time.Duration
 
+	// Creates skips the command if the path exists, Removes skips the command if the path doesn't exist
+	Creates string
+	Removes string
+	// SuccessCodes are exit codes besides 0 which mean the command succeeded
+	SuccessCodes []int
+	// UnchangedCodes are exit codes which mean the command succeeded without changing anything
+	UnchangedCodes []int
+	// ErrorLines is the number of lines of output attached to a CmdError, it defaults to 20
+	ErrorLines int
+	// ChangedOutput is a regexp, if it's set the command has only changed something if its output matches
+	ChangedOutput string
+	// Register stores the command's stdout, stderr, exit_code and duration in Props under the Register key,
+	// with RegisterJSON the stdout is parsed as json and stored under json. Commands aren't run in dry runs
+	// so nothing is registered, unless the command is ReadOnly.
+	Register     string
+	RegisterJSON bool
+	Props        *gopack.Properties
+	// ReadOnly commands don't change anything, they're run in dry runs too and never report a change
+	ReadOnly bool
+
+	// User and Group run the command with the user's uid, the group's gid and the user's supplementary groups,
+	// the user's group is used if Group is empty. HOME, USER and LOGNAME are set for the user.
+	User  string
+	Group string
+	// Env replaces the environment unless InheritEnv is set, then it's merged over the environment.
+	// The environment is inherited if Env is nil.
+	InheritEnv bool
+	// Stdin is the command's input, StdinFile is read for the input if Stdin is empty
+	Stdin     string
+	StdinFile string
+
 	gopack.BaseTask
 }
 
 // Run initializes default property values and delegates to BaseTask RunActions method
 func (c Command) Run(runActions ...action.Name) gopack.ActionRunStatus {
 	c.setDefaults()
+	if c.Creates != "" {
+		c.AddNotIf(FileExistsGuard(c.Creates))
+	}
+	if c.Removes != "" {
+		c.AddOnlyIf(FileExistsGuard(c.Removes))
+	}
 	return c.RunActions(&c, c.registerActions(), runActions)
 }
 
@@ -40,6 +87,9 @@ func (c *Command) setDefaults() {
 	if c.Timeout == 0 {
 		c.Timeout = 1 * time.Hour
 	}
+	if c.ErrorLines == 0 {
+		c.ErrorLines = 20
+	}
 }
 
 // String returns a string which identifies the task with it's property values
@@ -51,51 +101,301 @@ func (c Command) String() string {
 }
 
 func (c Command) run() (bool, error) {
-	if c.Stream {
-		if err := execCmdStream(gopack.NewTaskInfoWriter(), c.Timeout, c.Name, c.Env, c.Dir, c.Args...); err != nil {
-			return false, fmt.Errorf("unable to execute %s, %s", c, err)
+	if c.DryRun() && !c.ReadOnly {
+		// the guards of Creates and Removes have decided the command runs, without them the change is unknown
+		switch {
+		case c.Creates != "":
+			c.WouldChange(gopack.Drift{Resource: c.Creates, Attr: "state", Have: "absent", Want: "present"}, "run %s", c)
+		case c.Removes != "":
+			c.WouldChange(gopack.Drift{Resource: c.Removes, Attr: "state", Have: "present", Want: "absent"}, "run %s", c)
+		default:
+			c.Would("run %s", c)
 		}
-	} else {
-		b, err := execCmd(c.Timeout, c.Name, c.Env, c.Dir, c.Args...)
+		return true, nil
+	}
+	var changedOutput *regexp.Regexp
+	if c.ChangedOutput != "" {
+		x, err := regexp.Compile(c.ChangedOutput)
 		if err != nil {
-			return false, err
+			return false, fmt.Errorf("changed output %s not valid, %s", c.ChangedOutput, err)
 		}
-		if string(b) != "" {
-			gopack.NewTaskInfoWriter().Write(b)
+		changedOutput = x
+	}
+
+	out := &commandOutput{}
+	if c.Stream {
+		out.stream = c.Ctx().NewTaskInfoWriter()
+	}
+	start := time.Now()
+	err := runCmd(c.Ctx().Context(), c.Timeout, out.writer(&out.stdout), out.writer(&out.stderr), c.buildCmd)
+	if c.Register != "" {
+		if rerr := c.register(out, err, time.Since(start)); rerr != nil && err == nil {
+			return false, rerr
 		}
 	}
+	if hasExitCode(c.SuccessCodes, err) {
+		err = nil
+	}
+	if err != nil && !hasExitCode(c.UnchangedCodes, err) {
+		return false, newCmdError(c.String(), err, out.combined.String(), c.ErrorLines)
+	}
+	if !c.Stream && out.combined.Len() > 0 {
+		c.Ctx().NewTaskInfoWriter().Write(out.combined.Bytes())
+	}
+	if err != nil {
+		return false, nil
+	}
+	if c.ReadOnly {
+		return false, nil
+	}
+	if changedOutput != nil {
+		return changedOutput.Match(out.combined.Bytes()), nil
+	}
 	return true, nil
 }
 
-func execCmd(timeout time.Duration, command string, env []string, wd string, args ...string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// register stores the command's result in Props under the Register key
+func (c Command) register(out *commandOutput, err error, elapsed time.Duration) error {
+	if c.Props == nil {
+		return fmt.Errorf("unable to register %s, no props", c.Register)
+	}
+	code := 0
+	if err != nil {
+		code = -1
+		if x, ok := exitCode(err); ok {
+			code = x
+		}
+	}
+	result := map[string]interface{}{
+		"stdout":    out.stdout.String(),
+		"stderr":    out.stderr.String(),
+		"exit_code": code,
+		"duration":  elapsed.Seconds(),
+	}
+	if c.RegisterJSON {
+		var v interface{}
+		if err := json.Unmarshal(out.stdout.Bytes(), &v); err != nil {
+			return fmt.Errorf("unable to parse the output of %s as json, %s", c, err)
+		}
+		result["json"] = v
+	}
+	c.Props.Set(c.Register, result)
+	return nil
+}
 
-	cmd := exec.CommandContext(ctx, command, args...)
-	cmd.Env = env
-	if wd != "" {
-		cmd.Dir = wd
+// commandOutput captures the stdout, stderr and combined output of a command, the output is also
+// written to stream if it's set
+type commandOutput struct {
+	sync.Mutex
+	stdout   bytes.Buffer
+	stderr   bytes.Buffer
+	combined bytes.Buffer
+	stream   io.Writer
+}
+
+func (o *commandOutput) writer(b *bytes.Buffer) io.Writer {
+	return outputWriter{o: o, b: b}
+}
+
+type outputWriter struct {
+	o *commandOutput
+	b *bytes.Buffer
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.o.Lock()
+	defer w.o.Unlock()
+	w.b.Write(p)
+	w.o.combined.Write(p)
+	if w.o.stream != nil {
+		w.o.stream.Write(p)
 	}
-	b, err := cmd.CombinedOutput()
-	if ctx.Err() == context.DeadlineExceeded {
-		return b, ctx.Err()
+	return len(p), nil
+}
+
+// buildCmd builds the command with its environment, user, working directory and stdin
+func (c Command) buildCmd(ctx context.Context) (*exec.Cmd, error) {
+	env := c.Env
+	if c.InheritEnv || env == nil {
+		env = os.Environ()
+	}
+	cmd := newCmdIn(ctx, env, c.Dir, c.Name, c.Args...)
+
+	if c.User != "" || c.Group != "" {
+		cred, userEnv, err := credential(c.User, c.Group)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+		cmd.Env = mergeEnv(cmd.Env, userEnv)
 	}
+	// the variables of Env are always set as given
+	cmd.Env = mergeEnv(cmd.Env, c.Env)
+
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	} else if c.StdinFile != "" {
+		b, err := ioutil.ReadFile(c.StdinFile)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdin = bytes.NewReader(b)
+	}
+	return cmd, nil
+}
+
+// credential returns the credential of the user and group and the user's environment, the current user is used
+// if user is empty and the user's group is used if group is empty
+func credential(owner, group string) (*syscall.Credential, []string, error) {
+	uid, gid, err := lookupIds(owner, group)
 	if err != nil {
-		return b, err
+		return nil, nil, err
 	}
-	return b, nil
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return nil, nil, err
+	}
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, x := range gids {
+		id, err := strconv.Atoi(x)
+		if err != nil {
+			return nil, nil, err
+		}
+		cred.Groups = append(cred.Groups, uint32(id))
+	}
+	env := []string{"HOME=" + u.HomeDir, "USER=" + u.Username, "LOGNAME=" + u.Username}
+	return cred, env, nil
 }
 
-func execCmdStream(w io.Writer, timeout time.Duration, command string, env []string, wd string, args ...string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// mergeEnv returns env with the variables of overrides, replacing the variables already set
+func mergeEnv(env []string, overrides []string) []string {
+	merged := []string{}
+	index := map[string]int{}
+	for _, x := range append(append([]string{}, env...), overrides...) {
+		key := strings.SplitN(x, "=", 2)[0]
+		if i, found := index[key]; found {
+			merged[i] = x
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, x)
+	}
+	return merged
+}
+
+// hasExitCode returns true if err is the exit of a command with one of codes
+func hasExitCode(codes []int, err error) bool {
+	code, ok := exitCode(err)
+	if !ok {
+		return false
+	}
+	for _, x := range codes {
+		if x == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CmdError is returned when a command fails, ExitCode is -1 if the command didn't exit, e.g. it timed out.
+// Output is the last lines of the command's combined output.
+type CmdError struct {
+	Cmd      string
+	ExitCode int
+	Output   string
+	Err      error
+}
+
+func newCmdError(cmd string, err error, output string, lines int) *CmdError {
+	code, ok := exitCode(err)
+	if !ok {
+		code = -1
+	}
+	return &CmdError{Cmd: cmd, ExitCode: code, Output: tailLines(output, lines), Err: err}
+}
+
+func (e *CmdError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("unable to execute %s, %s", e.Cmd, e.Err)
+	}
+	return fmt.Sprintf("unable to execute %s, %s\n%s", e.Cmd, e.Err, e.Output)
+}
 
-	cmd := exec.CommandContext(ctx, command, args...)
-	cmd.Stdout = w
-	cmd.Stderr = w
+// Unwrap returns the error of the command's exit
+func (e *CmdError) Unwrap() error {
+	return e.Err
+}
+
+// tailLines returns the last n lines of s without the trailing newline
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func exitCode(err error) (int, bool) {
+	if x, ok := err.(*exec.ExitError); ok {
+		return x.ExitCode(), true
+	}
+	return 0, false
+}
+
+// stopWait is how long a canceled command has to exit after SIGTERM before it's killed
+const stopWait = 10 * time.Second
+
+func newCmd(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	// give the command a chance to clean up when the run is interrupted
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = stopWait
+	return cmd
+}
+
+func execCmd(parent context.Context, timeout time.Duration, command string, env []string, wd string, args ...string) ([]byte, error) {
+	b := &bytes.Buffer{}
+	err := runCmd(parent, timeout, b, b, func(ctx context.Context) (*exec.Cmd, error) {
+		return newCmdIn(ctx, env, wd, command, args...), nil
+	})
+	return b.Bytes(), err
+}
+
+func execCmdStream(parent context.Context, w io.Writer, timeout time.Duration, command string, env []string, wd string, args ...string) error {
+	return runCmd(parent, timeout, w, w, func(ctx context.Context) (*exec.Cmd, error) {
+		return newCmdIn(ctx, env, wd, command, args...), nil
+	})
+}
+
+func newCmdIn(ctx context.Context, env []string, wd string, command string, args ...string) *exec.Cmd {
+	cmd := newCmd(ctx, command, args...)
 	cmd.Env = env
 	if wd != "" {
 		cmd.Dir = wd
 	}
-	return cmd.Run()
+	return cmd
+}
+
+// runCmd runs the command built for the timeout's context with its output written to stdout and stderr
+func runCmd(parent context.Context, timeout time.Duration, stdout, stderr io.Writer, build func(ctx context.Context) (*exec.Cmd, error)) error {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	cmd, err := build(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
 }
@@ -2,8 +2,12 @@ package task
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,14 +41,199 @@ func TestExecCmdStreamFunc(t *testing.T) {
 	assert := assert.New(t)
 
 	buf := &bytes.Buffer{}
-	assert.NoError(execCmdStream(buf, 1*time.Second, "echo", []string{}, "", "hello"))
+	assert.NoError(execCmdStream(context.Background(), buf, 1*time.Second, "echo", []string{}, "", "hello"))
 	assert.Equal("hello\n", buf.String())
 }
 
 func TestExecCmdFunc(t *testing.T) {
 	assert := assert.New(t)
 
-	b, err := execCmd(1*time.Second, "echo", []string{}, "", "hello")
+	b, err := execCmd(context.Background(), 1*time.Second, "echo", []string{}, "", "hello")
 	assert.NoError(err)
 	assert.Equal("hello\n", string(b))
 }
+
+func TestExecCmdCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := execCmd(ctx, 10*time.Second, "sleep", []string{}, "", "5")
+	assert.Equal(context.Canceled, err)
+	assert.True(time.Since(start) < 5*time.Second)
+}
+
+func TestCommandCreatesRemoves(t *testing.T) {
+	assert := assert.New(t)
+	const testFile = "/tmp/test-command-creates"
+	defer os.Remove(testFile)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	c := Command{Name: "touch", Args: []string{testFile}, Creates: testFile}
+	assert.Equal(gopack.ActionRunStatus{action.Run: true}, c.Run(action.Run))
+	assert.Equal(gopack.ActionRunStatus{}, c.Run(action.Run))
+	assert.Regexp(`command touch.*skipped due to not_if /tmp/test-command-creates exists`, buf.String())
+
+	c = Command{Name: "rm", Args: []string{testFile}, Removes: testFile}
+	assert.Equal(gopack.ActionRunStatus{action.Run: true}, c.Run(action.Run))
+	assert.Equal(gopack.ActionRunStatus{}, c.Run(action.Run))
+	assert.Regexp(`command rm.*skipped due to only_if /tmp/test-command-creates exists`, buf.String())
+
+	rc := gopack.NewRunContext(log.New(buf, "", 0))
+	rc.DryRun = true
+	c = Command{Name: "touch", Args: []string{testFile}, Creates: testFile, BaseTask: gopack.BaseTask{RunContext: rc}}
+	assert.Equal(gopack.ActionRunStatus{action.Run: true}, c.Run(action.Run))
+	assert.Regexp(`\+ state present`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestCommandChanged(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	c := Command{Name: "sh", Args: []string{"-c", "exit 2"}, UnchangedCodes: []int{2}}
+	assert.Equal(gopack.ActionRunStatus{action.Run: false}, c.Run(action.Run))
+	_, err := gopack.RunE(Command{Name: "sh", Args: []string{"-c", "exit 3"}, UnchangedCodes: []int{2}}, action.Run)
+	assert.Error(err)
+
+	for _, stream := range []bool{false, true} {
+		c = Command{Name: "echo", Args: []string{"migrated 2 tables"}, ChangedOutput: `migrated [1-9]`, Stream: stream}
+		assert.Equal(gopack.ActionRunStatus{action.Run: true}, c.Run(action.Run))
+		c.Args = []string{"migrated 0 tables"}
+		assert.Equal(gopack.ActionRunStatus{action.Run: false}, c.Run(action.Run))
+	}
+	fmt.Print(buf.String())
+}
+
+func TestCommandEnvStdin(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	os.Setenv("TEST_COMMAND_ENV", "inherited")
+	defer os.Unsetenv("TEST_COMMAND_ENV")
+
+	Command{Name: "sh", Args: []string{"-c", "echo env=$TEST_COMMAND_ENV,$TEST_COMMAND_OWN"}, Env: []string{"TEST_COMMAND_OWN=own"}}.Run(action.Run)
+	assert.Regexp(`env=,own`, buf.String())
+	Command{Name: "sh", Args: []string{"-c", "echo inherit=$TEST_COMMAND_ENV,$TEST_COMMAND_OWN"}, Env: []string{"TEST_COMMAND_OWN=own"}, InheritEnv: true}.Run(action.Run)
+	assert.Regexp(`inherit=inherited,own`, buf.String())
+
+	Command{Name: "cat", Stdin: "from stdin\n"}.Run(action.Run)
+	assert.Regexp(`from stdin`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestCommandRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	props := &gopack.Properties{}
+	Command{Name: "sh", Args: []string{"-c", `echo '{"a": [1, 2]}'; echo oops >&2`}, Register: "out", RegisterJSON: true, Props: props}.Run(action.Run)
+	out := (*props)["out"].(map[string]interface{})
+	assert.Equal("{\"a\": [1, 2]}\n", out["stdout"])
+	assert.Equal("oops\n", out["stderr"])
+	assert.Equal(0, out["exit_code"])
+	assert.Equal(map[string]interface{}{"a": []interface{}{1.0, 2.0}}, out["json"])
+
+	_, err := gopack.RunE(Command{Name: "sh", Args: []string{"-c", "exit 3"}, Register: "fail", Props: props}, action.Run)
+	assert.Error(err)
+	assert.Equal(3, (*props)["fail"].(map[string]interface{})["exit_code"])
+
+	_, err = gopack.RunE(Command{Name: "echo", Args: []string{"not json"}, Register: "bad", RegisterJSON: true, Props: props}, action.Run)
+	assert.Error(err)
+	_, err = gopack.RunE(Command{Name: "echo", Register: "none"}, action.Run)
+	assert.Error(err)
+
+	// only read only commands are run and registered in dry runs
+	rc := gopack.NewRunContext(log.New(buf, "", 0))
+	rc.DryRun = true
+	status := Command{Name: "echo", Args: []string{"1.2.3"}, Register: "dry", Props: props, BaseTask: gopack.BaseTask{RunContext: rc}}.Run(action.Run)
+	assert.True(status[action.Run])
+	assert.False(props.Exists("dry"))
+	status = Command{Name: "echo", Args: []string{"1.2.3"}, Register: "version", Props: props, ReadOnly: true, BaseTask: gopack.BaseTask{RunContext: rc}}.Run(action.Run)
+	assert.False(status[action.Run])
+	assert.Equal("1.2.3\n", props.Map("version")["stdout"])
+
+	// commands run concurrently can register their output
+	g := gopack.Graph{Name: "register", Workers: 4}
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("node%d", i)
+		g.Add(key, func(rc *gopack.RunContext) {
+			rc.Run(Command{Name: "echo", Args: []string{key}, Register: key, Props: props}, action.Run)
+			assert.True(props.Exists(key))
+		})
+	}
+	g.Run(action.Run)
+	for i := 0; i < 8; i++ {
+		assert.Equal(fmt.Sprintf("node%d\n", i), props.Map(fmt.Sprintf("node%d", i))["stdout"])
+	}
+	fmt.Print(buf.String())
+}
+
+func TestCommandSuccessCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	_, err := gopack.RunE(Command{Name: "sh", Args: []string{"-c", "exit 1"}, SuccessCodes: []int{1}}, action.Run)
+	assert.NoError(err)
+
+	_, err = gopack.RunE(Command{Name: "sh", Args: []string{"-c", "echo one; echo two; echo three; exit 4"}, ErrorLines: 2}, action.Run)
+	cerr := &CmdError{}
+	if assert.True(errors.As(err, &cerr)) {
+		assert.Equal(4, cerr.ExitCode)
+		assert.Equal("two\nthree", cerr.Output)
+		assert.Contains(err.Error(), "exit status 4\ntwo\nthree")
+	}
+
+	// stdout and stderr are both in the output, their order isn't fixed
+	_, err = gopack.RunE(Command{Name: "sh", Args: []string{"-c", "echo out; echo err >&2; exit 4"}}, action.Run)
+	if assert.True(errors.As(err, &cerr)) {
+		assert.ElementsMatch([]string{"out", "err"}, strings.Split(cerr.Output, "\n"))
+	}
+
+	_, err = gopack.RunE(Command{Name: "sleep", Args: []string{"1"}, Timeout: 10 * time.Millisecond}, action.Run)
+	if assert.True(errors.As(err, &cerr)) {
+		assert.Equal(-1, cerr.ExitCode)
+	}
+	fmt.Print(buf.String())
+}
+
+func TestCommandUser(t *testing.T) {
+	assert := assert.New(t)
+	if os.Geteuid() != 0 {
+		t.Skip("running as another user requires root")
+	}
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	Command{Name: "sh", Args: []string{"-c", "echo $(id -un) $HOME"}, User: "nobody"}.Run(action.Run)
+	assert.Regexp(`nobody /nonexistent`, buf.String())
+	fmt.Print(buf.String())
+}
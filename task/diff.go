@@ -0,0 +1,145 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around changes
+	diffContext = 3
+	// diffMaxCells limits the size of the table used to find the common lines
+	diffMaxCells = 4 * 1024 * 1024
+)
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns the unified diff of from and to, an empty string is returned if they're equal
+func UnifiedDiff(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+	a, b := splitLines(from), splitLines(to)
+	if len(a)*len(b) > diffMaxCells {
+		return fmt.Sprintf("--- %s\n+++ %s\n@@ %d lines changed to %d lines, too large to diff @@\n", fromName, toName, len(a), len(b))
+	}
+
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName)
+	ops := diffLines(a, b)
+	for start := 0; start < len(ops); {
+		// find the next change and the end of its hunk
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		end, equal := start, 0
+		for i := start; i < len(ops) && equal <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				equal++
+				continue
+			}
+			equal = 0
+			end = i + 1
+		}
+		first, last := start-diffContext, end+diffContext
+		if first < 0 {
+			first = 0
+		}
+		if last > len(ops) {
+			last = len(ops)
+		}
+		writeHunk(w, ops, first, last)
+		start = end
+	}
+	return w.String()
+}
+
+func writeHunk(w *bytes.Buffer, ops []diffOp, first, last int) {
+	// line numbers of the hunk in from and to
+	aStart, bStart := 1, 1
+	for _, op := range ops[:first] {
+		if op.kind != '+' {
+			aStart++
+		}
+		if op.kind != '-' {
+			bStart++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, op := range ops[first:last] {
+		if op.kind != '+' {
+			aLen++
+		}
+		if op.kind != '-' {
+			bLen++
+		}
+	}
+	if aLen == 0 {
+		aStart--
+	}
+	if bLen == 0 {
+		bStart--
+	}
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, op := range ops[first:last] {
+		fmt.Fprintf(w, "%c%s\n", op.kind, op.line)
+	}
+}
+
+// diffLines returns the edit script from a to b using their longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
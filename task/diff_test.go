@@ -0,0 +1,48 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := []string{}
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	from := strings.Join(lines, "\n") + "\n"
+	lines[1] = "line two"
+	lines = append(lines[:15], lines[16:]...)
+	to := strings.Join(lines, "\n") + "\n"
+
+	assert.Equal("", UnifiedDiff("a", "b", []byte(from), []byte(from)))
+	assert.Equal(`--- a
++++ b
+@@ -1,5 +1,5 @@
+ line 1
+-line 2
++line two
+ line 3
+ line 4
+ line 5
+@@ -13,7 +13,6 @@
+ line 13
+ line 14
+ line 15
+-line 16
+ line 17
+ line 18
+ line 19
+`, UnifiedDiff("a", "b", []byte(from), []byte(to)))
+	assert.Equal(`--- a
++++ b
+@@ -0,0 +1,2 @@
++line 1
++line 2
+`, UnifiedDiff("a", "b", nil, []byte("line 1\nline 2\n")))
+}
@@ -56,13 +56,21 @@ func (d Directory) create() (bool, error) {
 		return false, err
 	}
 	if !found {
+		if d.DryRun() {
+			d.WouldChange(gopack.Drift{Resource: d.Path, Attr: "state", Have: "absent", Want: "present"}, "create %s", d.Path)
+			return true, nil
+		}
 		chgDirectory = true
 		if err = os.MkdirAll(d.Path, d.Perm); err != nil {
 			return false, err
 		}
 	} else {
 		if fi.Mode().Perm() != d.Perm.Perm() {
-			os.Chmod(d.Path, d.Perm)
+			if d.DryRun() {
+				d.WouldChange(ModeDrift(d.Path, fi.Mode(), d.Perm), "chmod %s from %s to %s", d.Path, fi.Mode().Perm(), d.Perm.Perm())
+			} else {
+				os.Chmod(d.Path, d.Perm)
+			}
 			chgMode = true
 		}
 	}
@@ -70,7 +78,14 @@ func (d Directory) create() (bool, error) {
 	if d.Owner == "" && d.Group == "" {
 		return chgDirectory || chgOwnership || chgMode, nil
 	}
-	if chgOwnership, err = Chown(d.Path, d.Owner, d.Group); err != nil {
+	if d.DryRun() {
+		if chgOwnership, err = ChownRequired(d.Path, d.Owner, d.Group); chgOwnership {
+			d.WouldChange(OwnerDrift(d.Path, d.Owner, d.Group), "chown %s to %s:%s", d.Path, d.Owner, d.Group)
+		}
+	} else {
+		chgOwnership, err = Chown(d.Path, d.Owner, d.Group)
+	}
+	if err != nil {
 		return false, err
 	}
 	return chgDirectory || chgOwnership || chgMode, nil
@@ -87,12 +102,96 @@ func (d Directory) remove() (bool, error) {
 	if !found {
 		return false, nil
 	}
+	if d.DryRun() {
+		d.WouldChange(gopack.Drift{Resource: d.Path, Attr: "state", Have: "present", Want: "absent"}, "remove %s", d.Path)
+		return true, nil
+	}
 	//TODO: optionally allow RemoveAll
 	err = os.Remove(d.Path)
 	return true, err
 }
 
+// Chown sets the ownership of path, returns true if the ownership was changed
 func Chown(path, owner, group string) (bool, error) {
+	uid, gid, required, err := ownership(path, owner, group)
+	if err != nil || !required {
+		return false, err
+	}
+	if err = os.Chown(path, uid, gid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ChownRequired returns true if the ownership of path differs from owner and group
+func ChownRequired(path, owner, group string) (bool, error) {
+	_, _, required, err := ownership(path, owner, group)
+	return required, err
+}
+
+// Ownership returns the names of the owner and group of path, the ids are returned for unknown names
+func Ownership(path string) (string, string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", fmt.Errorf("syscall is nil for %s", path)
+	}
+	owner := strconv.Itoa(int(st.Uid))
+	group := strconv.Itoa(int(st.Gid))
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner, group, nil
+}
+
+// ModeDrift returns the drift of the mode of the file at path
+func ModeDrift(path string, have, want os.FileMode) gopack.Drift {
+	return gopack.Drift{Resource: path, Attr: "mode", Have: have.Perm().String(), Want: want.Perm().String()}
+}
+
+// OwnerDrift returns the drift of the ownership of the file at path
+func OwnerDrift(path, owner, group string) gopack.Drift {
+	d := gopack.Drift{Resource: path, Attr: "owner", Want: fmt.Sprintf("%s:%s", owner, group)}
+	if o, g, err := Ownership(path); err == nil {
+		d.Have = fmt.Sprintf("%s:%s", o, g)
+	}
+	return d
+}
+
+func ownership(path, owner, group string) (int, int, bool, error) {
+	uid, gid, err := lookupIds(owner, group)
+	if err != nil {
+		return uid, gid, false, err
+	}
+
+	// check if ownership is differrent then provided
+	var (
+		fi     os.FileInfo
+		uidNow int
+		gidNow int
+	)
+	if fi, err = os.Stat(path); err != nil {
+		return uid, gid, false, err
+	}
+	if fi.Sys() != nil {
+		uidNow = int(fi.Sys().(*syscall.Stat_t).Uid)
+		gidNow = int(fi.Sys().(*syscall.Stat_t).Gid)
+	} else {
+		return uid, gid, false, fmt.Errorf("syscall is nil for %s", path)
+	}
+
+	return uid, gid, uid != uidNow || gid != gidNow, nil
+}
+
+// lookupIds returns the ids of owner and group, the current user is used if owner is empty
+// and the owner's group is used if group is empty
+func lookupIds(owner, group string) (int, int, error) {
 	var (
 		err      error
 		u        *user.User
@@ -103,55 +202,29 @@ func Chown(path, owner, group string) (bool, error) {
 	// use current user if no owner provided
 	if owner == "" {
 		if u, err = user.Current(); err != nil {
-			return false, err
+			return uid, gid, err
 		}
 	} else {
 		if u, err = user.Lookup(owner); err != nil {
-			return false, err
+			return uid, gid, err
 		}
 	}
 	if uid, err = strconv.Atoi(u.Uid); err != nil {
-		return false, err
+		return uid, gid, err
 	}
 
 	// use user's group if no group provided
 	if group == "" {
 		if gid, err = strconv.Atoi(u.Gid); err != nil {
-			return false, err
+			return uid, gid, err
 		}
 	} else {
 		if g, err = user.LookupGroup(group); err != nil {
-			return false, err
+			return uid, gid, err
 		}
 		if gid, err = strconv.Atoi(g.Gid); err != nil {
-			return false, err
+			return uid, gid, err
 		}
 	}
-
-	// check if ownership is differrent then provided
-	var (
-		fi     os.FileInfo
-		uidNow int
-		gidNow int
-	)
-	if fi, err = os.Stat(path); err != nil {
-		return false, err
-	}
-	if fi.Sys() != nil {
-		uidNow = int(fi.Sys().(*syscall.Stat_t).Uid)
-		gidNow = int(fi.Sys().(*syscall.Stat_t).Gid)
-	} else {
-		return false, fmt.Errorf("syscall is nil for %s", path)
-	}
-
-	if uid == uidNow && gid == gidNow {
-		return false, nil
-	}
-
-	// set ownership
-	if err = os.Chown(path, uid, gid); err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return uid, gid, nil
 }
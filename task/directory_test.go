@@ -72,6 +72,29 @@ func TestCreateDirectoryValidOwner(t *testing.T) {
 
 }
 
+func TestCreateDirectoryDryRun(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/create-dir-dry-run"
+
+	buf := &bytes.Buffer{}
+	rc := gopack.NewRunContext(log.New(buf, "", 0))
+	rc.DryRun = true
+
+	Directory{
+		Path:     testDir,
+		Perm:     0755,
+		BaseTask: gopack.BaseTask{RunContext: rc},
+	}.Run(action.Create)
+	defer os.Remove(testDir)
+
+	_, err := os.Stat(testDir)
+	assert.True(os.IsNotExist(err))
+	assert.Regexp(`would create /tmp/create-dir-dry-run`, buf.String())
+	assert.Regexp(`- state absent`, buf.String())
+	assert.Regexp(`\+ state present`, buf.String())
+	assert.Regexp(`.*directory.*/tmp/create-dir-dry-run.*create.*(would run)`, buf.String())
+}
+
 func TestRemoveDirectory(t *testing.T) {
 	assert := assert.New(t)
 	const testDir = "/tmp/remove-dir"
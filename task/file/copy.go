@@ -1,6 +1,8 @@
 package file
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -18,6 +20,13 @@ type Copy struct {
 	Group string
 	Perm  os.FileMode
 
+	// Sensitive suppresses the diff of the file's content when it's replaced
+	Sensitive bool
+	// Backup is the policy for backups of the file copied to before it's replaced
+	Backup task.Backup
+	// Verify is a command line run against the copied file before it replaces the file, e.g. nginx -t -c %{path}
+	Verify string
+
 	gopack.BaseTask
 }
 
@@ -41,6 +50,23 @@ func (c Copy) String() string {
 	return fmt.Sprintf("copy %s %s %s %s %s", c.From, c.To, c.Owner, c.Group, c.Perm)
 }
 
+// Diff returns the unified diff of the file copied to and the file copied from without copying it,
+// an empty string is returned if the file copied to doesn't exist
+func (c Copy) Diff() (string, error) {
+	to, err := ioutil.ReadFile(c.To)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	from, err := ioutil.ReadFile(c.From)
+	if err != nil {
+		return "", err
+	}
+	return task.UnifiedDiff(c.To, c.From, to, from), nil
+}
+
 func (c Copy) run() (bool, error) {
 	_, exists, err := task.Fexists(c.From)
 	if err != nil {
@@ -49,15 +75,101 @@ func (c Copy) run() (bool, error) {
 	if !exists {
 		return false, nil
 	}
-	b, err := ioutil.ReadFile(c.From)
+	d, err := c.drift()
 	if err != nil {
 		return false, err
 	}
-	if err := ioutil.WriteFile(c.To, b, c.Perm); err != nil {
+	if d == nil {
+		// the content is the same, the file is neither written nor backed up
+		return c.update()
+	}
+	if !c.Sensitive {
+		diff, err := c.Diff()
+		if err != nil {
+			return false, err
+		}
+		c.Ctx().NewTaskInfoWriter().Write([]byte(diff))
+	}
+	if c.DryRun() {
+		c.WouldChange(*d, "copy %s to %s", c.From, c.To)
+		return true, nil
+	}
+	b, err := ioutil.ReadFile(c.From)
+	if err != nil {
 		return false, err
 	}
-	if _, err := task.Chown(c.To, c.Owner, c.Group); err != nil {
+	if err := c.write(b); err != nil {
 		return false, err
 	}
 	return true, nil
 }
+
+// update sets the mode and ownership of the file copied to if they differ
+func (c Copy) update() (bool, error) {
+	changed := false
+	if c.Perm != 0 {
+		fi, err := os.Stat(c.To)
+		if err != nil {
+			return false, err
+		}
+		if fi.Mode().Perm() != c.Perm.Perm() {
+			if c.DryRun() {
+				c.WouldChange(task.ModeDrift(c.To, fi.Mode(), c.Perm), "chmod %s from %s to %s", c.To, fi.Mode().Perm(), c.Perm.Perm())
+			} else if err = os.Chmod(c.To, c.Perm); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+	if c.Owner == "" && c.Group == "" {
+		return changed, nil
+	}
+	if c.DryRun() {
+		required, err := task.ChownRequired(c.To, c.Owner, c.Group)
+		if required {
+			c.WouldChange(task.OwnerDrift(c.To, c.Owner, c.Group), "chown %s to %s:%s", c.To, c.Owner, c.Group)
+		}
+		return changed || required, err
+	}
+	chown, err := task.Chown(c.To, c.Owner, c.Group)
+	return changed || chown, err
+}
+
+// drift returns the drift of the file copied to, nil is returned if its content is the same as the file copied from
+func (c Copy) drift() (*gopack.Drift, error) {
+	from, err := ioutil.ReadFile(c.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ioutil.ReadFile(c.To)
+	if os.IsNotExist(err) {
+		return &gopack.Drift{Resource: c.To, Attr: "state", Have: "absent", Want: "present"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sumf, sumt := sha256.Sum256(from), sha256.Sum256(to)
+	if sumf == sumt {
+		return nil, nil
+	}
+	return &gopack.Drift{Resource: c.To, Attr: "sha256", Have: hex.EncodeToString(sumt[:]), Want: hex.EncodeToString(sumf[:])}, nil
+}
+
+// write verifies the copied file and backs up the file copied to before it's replaced
+func (c Copy) write(b []byte) error {
+	f, err := task.NewAtomicFile(c.To, c.Perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Verify(c.Ctx(), c.Verify)
+	}
+	if err == nil {
+		err = task.BackupFile(c.Ctx(), c.Backup, c.To)
+	}
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit(c.Owner, c.Group)
+}
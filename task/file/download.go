@@ -43,24 +43,33 @@ func (d Download) String() string {
 }
 
 func (d Download) create() (bool, error) {
-	out, err := os.OpenFile(d.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, d.Perm)
+	if d.DryRun() {
+		d.Would("download %s to %s", d.URL, d.Path)
+		return true, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, d.URL, nil)
 	if err != nil {
 		return false, err
 	}
-	defer out.Close()
-
-	resp, err := http.Get(d.URL)
+	resp, err := http.DefaultClient.Do(req.WithContext(d.Ctx().Context()))
 	if err != nil {
 		return false, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("unable to download %s, %s", d.URL, resp.Status)
+	}
 
-	_, err = io.Copy(out, resp.Body)
+	// the file is only replaced once the transfer has succeeded
+	out, err := task.NewAtomicFile(d.Path, d.Perm)
 	if err != nil {
 		return false, err
 	}
-
-	if _, err := task.Chown(d.Path, d.Owner, d.Group); err != nil {
+	if _, err = io.Copy(out, resp.Body); err != nil {
+		out.Abort()
+		return false, err
+	}
+	if err = out.Commit(d.Owner, d.Group); err != nil {
 		return false, err
 	}
 	return true, nil
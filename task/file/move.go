@@ -18,6 +18,9 @@ type Move struct {
 	Group string
 	Perm  os.FileMode
 
+	// Backup is the policy for backups of the file moved to before it's replaced
+	Backup task.Backup
+
 	gopack.BaseTask
 }
 
@@ -49,14 +52,18 @@ func (m Move) run() (bool, error) {
 	if !exists {
 		return false, nil
 	}
+	if m.DryRun() {
+		m.WouldChange(gopack.Drift{Resource: m.From, Attr: "state", Have: "present", Want: "absent"}, "move %s to %s", m.From, m.To)
+		return true, nil
+	}
 	b, err := ioutil.ReadFile(m.From)
 	if err != nil {
 		return false, err
 	}
-	if err := ioutil.WriteFile(m.To, b, m.Perm); err != nil {
+	if err := task.BackupFile(m.Ctx(), m.Backup, m.To); err != nil {
 		return false, err
 	}
-	if _, err := task.Chown(m.To, m.Owner, m.Group); err != nil {
+	if err := task.WriteFileAtomic(m.To, b, m.Perm, m.Owner, m.Group); err != nil {
 		return false, err
 	}
 	if err := os.Remove(m.From); err != nil {
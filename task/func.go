@@ -35,5 +35,9 @@ func (f Func) String() string {
 }
 
 func (f Func) run() (bool, error) {
+	if f.DryRun() {
+		f.Would("run %s", f)
+		return true, nil
+	}
 	return f.ActionFunc()
 }
@@ -0,0 +1,95 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFuncs returns the funcs available to templates. Funcs which take a value have it as their
+// last argument so they can be used in pipelines, e.g. {{ env "PORT" | default "8080" }}.
+// The decrypt func decrypts encrypted property values with key, see Decrypt.
+func TemplateFuncs(key string, base64Key bool) template.FuncMap {
+	return template.FuncMap{
+		"default":   defaultValue,
+		"required":  required,
+		"env":       os.Getenv,
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"trim":      strings.TrimSpace,
+		"quote":     func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+		"replace":   func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":      join,
+		"list":      func(v ...interface{}) []interface{} { return v },
+		"indent":    indent,
+		"toJSON":    toJSON,
+		"toYAML":    toYAML,
+		"decrypt": func(encrypted string) (string, error) {
+			return Decrypt(encrypted, key, base64Key)
+		},
+	}
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+func required(msg string, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, fmt.Errorf("required value missing, %s", msg)
+	}
+	return v, nil
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	x := reflect.ValueOf(v)
+	switch x.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return x.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return x.IsNil()
+	}
+	return x.IsZero()
+}
+
+func join(sep string, list interface{}) (string, error) {
+	x := reflect.ValueOf(list)
+	if x.Kind() != reflect.Slice && x.Kind() != reflect.Array {
+		return "", fmt.Errorf("unable to join %T, not a list", list)
+	}
+	items := []string{}
+	for i := 0; i < x.Len(); i++ {
+		items = append(items, fmt.Sprint(x.Index(i).Interface()))
+	}
+	return strings.Join(items, sep), nil
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(b), "\n"), err
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mschenk42/gopack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	assert := assert.New(t)
+
+	encrypted, key, err := Encrypt("secret", "", false)
+	assert.NoError(err)
+	os.Setenv("TEST_TEMPLATE_FUNCS", "from env")
+	defer os.Unsetenv("TEST_TEMPLATE_FUNCS")
+
+	props := &gopack.Properties{
+		"name":     "app",
+		"hosts":    []interface{}{"a", "b"},
+		"server":   map[string]interface{}{"port": 8080.0},
+		"password": encrypted,
+	}
+	tmpl := Template{
+		Name: "funcs",
+		Source: `{{ index . "missing" | default "none" }}
+{{ index . "name" | upper }}
+{{ index . "hosts" | join "," }}
+{{ env "TEST_TEMPLATE_FUNCS" }}
+{{ index . "server" | toJSON }}
+server:
+{{ index . "server" | toYAML | indent 2 }}
+{{ index . "password" | decrypt }}`,
+		Props:      props,
+		DecryptKey: key,
+	}
+	b, decrypted, err := tmpl.render()
+	assert.NoError(err)
+	assert.True(decrypted)
+	assert.Equal("none\nAPP\na,b\nfrom env\n{\"port\":8080}\nserver:\n  port: 8080\nsecret", string(b))
+
+	tmpl.Source = `{{ index . "missing" | required "missing is not set" }}`
+	_, _, err = tmpl.render()
+	assert.Error(err)
+	assert.Regexp("missing is not set", err.Error())
+}
+
+func TestTemplateSourceFile(t *testing.T) {
+	assert := assert.New(t)
+
+	fsys := fstest.MapFS{
+		"templates/nginx.conf.tmpl": {Data: []byte(`{{ template "server.tmpl" . }}`)},
+		"templates/server.tmpl":     {Data: []byte(`listen {{ index . "port" }};`)},
+	}
+	tmpl := Template{
+		Name:       "nginx",
+		SourceFile: "templates/nginx.conf.tmpl",
+		FS:         fsys,
+		Partials:   "templates/server.tmpl",
+		Props:      &gopack.Properties{"port": 80},
+	}
+	b, decrypted, err := tmpl.render()
+	assert.NoError(err)
+	assert.False(decrypted)
+	assert.Equal("listen 80;", string(b))
+
+	tmpl.SourceFile = "templates/missing.tmpl"
+	_, _, err = tmpl.render()
+	assert.Error(err)
+}
@@ -42,6 +42,10 @@ func (g Group) create() (bool, error) {
 			return false, err
 		}
 	}
+	if g.DryRun() {
+		g.WouldChange(gopack.Drift{Resource: "group " + g.Name, Attr: "state", Have: "absent", Want: "present"}, "create group %s", g.Name)
+		return true, nil
+	}
 	createGroup(g)
 	return true, nil
 }
@@ -50,6 +54,10 @@ func (g Group) remove() (bool, error) {
 	if _, err := user.LookupGroup(g.Name); err != nil {
 		return false, err
 	}
+	if g.DryRun() {
+		g.WouldChange(gopack.Drift{Resource: "group " + g.Name, Attr: "state", Have: "present", Want: "absent"}, "remove group %s", g.Name)
+		return true, nil
+	}
 	removeGroup(g)
 	return true, nil
 }
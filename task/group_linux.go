@@ -3,6 +3,7 @@ package task
 import (
 	"time"
 
+	"github.com/mschenk42/gopack"
 	"github.com/mschenk42/gopack/action"
 )
 
@@ -11,6 +12,8 @@ func createGroup(g Group) {
 		Name:    "groupadd",
 		Args:    []string{g.Name},
 		Timeout: time.Second * 10,
+
+		BaseTask: gopack.BaseTask{RunContext: g.RunContext},
 	}.Run(action.Run)
 }
 
@@ -19,5 +22,7 @@ func removeGroup(g Group) {
 		Name:    "groupdel",
 		Args:    []string{g.Name},
 		Timeout: time.Second * 10,
+
+		BaseTask: gopack.BaseTask{RunContext: g.RunContext},
 	}.Run(action.Run)
 }
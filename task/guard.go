@@ -0,0 +1,73 @@
+package task
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/mschenk42/gopack"
+)
+
+// ShellGuard runs a command line with sh -c, the guard is true if the command exits with 0
+type ShellGuard struct {
+	Cmd        string
+	Env        []string
+	Dir        string
+	Timeout    time.Duration
+	RunContext *gopack.RunContext
+}
+
+// Guard returns the guard for OnlyIf and NotIf, the command line identifies it in the log
+func (s ShellGuard) Guard() gopack.Guard {
+	s.setDefaults()
+	return gopack.Guard{
+		Desc: fmt.Sprintf("`%s`", s.Cmd),
+		Cond: s.run,
+	}
+}
+
+func (s *ShellGuard) setDefaults() {
+	if s.Timeout == 0 {
+		s.Timeout = 1 * time.Minute
+	}
+}
+
+func (s ShellGuard) run() (bool, error) {
+	rc := s.RunContext
+	if rc == nil {
+		rc = gopack.DefaultRunContext
+	}
+	b, err := execCmd(rc.Context(), s.Timeout, "sh", s.Env, s.Dir, "-c", s.Cmd)
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to run guard `%s`, %s %s", s.Cmd, err, b)
+	}
+	return true, nil
+}
+
+// FileExistsGuard returns a guard which is true if path exists
+func FileExistsGuard(path string) gopack.Guard {
+	return gopack.Guard{
+		Desc: fmt.Sprintf("%s exists", path),
+		Cond: func() (bool, error) {
+			_, found, err := Fexists(path)
+			return found, err
+		},
+	}
+}
+
+// PropertyEqualsGuard returns a guard which is true if the property key is set to value
+func PropertyEqualsGuard(props *gopack.Properties, key string, value interface{}) gopack.Guard {
+	return gopack.Guard{
+		Desc: fmt.Sprintf("%s is %v", key, value),
+		Cond: func() (bool, error) {
+			if !props.Exists(key) {
+				return false, nil
+			}
+			// property values are loaded from json, compare them as strings so 1 equals 1.0
+			return fmt.Sprint((*props)[key]) == fmt.Sprint(value), nil
+		},
+	}
+}
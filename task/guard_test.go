@@ -0,0 +1,62 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/mschenk42/gopack"
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	ok, err := ShellGuard{Cmd: "test -d /"}.Guard().Cond()
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = ShellGuard{Cmd: "exit 1"}.Guard().Cond()
+	assert.NoError(err)
+	assert.False(ok)
+	_, err = ShellGuard{Cmd: "true", Dir: "/not/a/dir"}.Guard().Cond()
+	assert.Error(err)
+
+	c := Command{Name: "echo", Args: []string{"hello"}}
+	c.AddNotIf(ShellGuard{Cmd: "test -d /"}.Guard())
+	assert.Equal(gopack.ActionRunStatus{}, c.Run(action.Run))
+	assert.Regexp("command.*echo.*skipped due to not_if `test -d /`", buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestFileExistsGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	ok, err := FileExistsGuard(os.TempDir()).Cond()
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = FileExistsGuard("/not/a/file").Cond()
+	assert.NoError(err)
+	assert.False(ok)
+}
+
+func TestPropertyEqualsGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	props := &gopack.Properties{"env": "prod", "workers": 2.0}
+	ok, _ := PropertyEqualsGuard(props, "env", "prod").Cond()
+	assert.True(ok)
+	ok, _ = PropertyEqualsGuard(props, "workers", 2).Cond()
+	assert.True(ok)
+	ok, _ = PropertyEqualsGuard(props, "env", "dev").Cond()
+	assert.False(ok)
+	ok, _ = PropertyEqualsGuard(props, "missing", "").Cond()
+	assert.False(ok)
+}
@@ -1,14 +1,22 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/mschenk42/gopack"
 	"github.com/mschenk42/gopack/action"
 )
 
-// Package ...
+// packageQueryTimeout is how long a query of a package's state has to finish
+const packageQueryTimeout = 5 * time.Minute
+
+// Package installs, upgrades and removes packages with apt-get or yum. A name can be pinned to
+// a version with name=version. Only the packages which aren't in the requested state are changed.
+// Install is run when no action is given.
 type Package struct {
 	Names []string
 
@@ -18,12 +26,17 @@ type Package struct {
 // Run initializes default property values and delegates to BaseTask RunActions method
 func (p Package) Run(runActions ...action.Name) gopack.ActionRunStatus {
 	p.setDefaults()
+	if len(runActions) == 0 {
+		runActions = action.NewSlice(action.Install)
+	}
 	return p.RunActions(&p, p.registerActions(), runActions)
 }
 
 func (p Package) registerActions() action.Funcs {
 	return action.Funcs{
 		action.Install: p.install,
+		action.Upgrade: p.upgrade,
+		action.Remove:  p.remove,
 	}
 }
 
@@ -36,42 +49,320 @@ func (p Package) String() string {
 }
 
 func (p Package) install() (bool, error) {
-	c, err := p.packageCommand()
+	return p.apply(action.Install)
+}
+
+func (p Package) upgrade() (bool, error) {
+	return p.apply(action.Upgrade)
+}
+
+func (p Package) remove() (bool, error) {
+	return p.apply(action.Remove)
+}
+
+// apply runs the package manager for the packages which aren't in the state of the action
+// and logs the packages which changed
+func (p Package) apply(a action.Name) (bool, error) {
+	m, err := findPackageManager()
+	if err != nil {
+		return false, err
+	}
+	specs := parsePackages(p.Names)
+	before, err := m.versions(p.Ctx().Context(), specs)
 	if err != nil {
 		return false, err
 	}
-	return c.Run(action.Run)[action.Run], nil
+
+	pending := []string{}
+	pinned := false
+	for _, s := range specs {
+		have := before[s.name]
+		want, err := p.wants(m, a, s, have)
+		if err != nil {
+			return false, err
+		}
+		if want == "" {
+			continue
+		}
+		if a == action.Remove {
+			pending = append(pending, s.name)
+		} else {
+			pending = append(pending, m.pin(s))
+			pinned = pinned || s.version != ""
+		}
+		if p.DryRun() {
+			if have == "" {
+				have = "absent"
+			}
+			p.WouldChange(gopack.Drift{Resource: "package " + s.name, Attr: "version", Have: have, Want: want}, "%s %s", a, s)
+		}
+	}
+	if len(pending) == 0 {
+		return false, nil
+	}
+	if p.DryRun() {
+		return true, nil
+	}
+
+	c := Command{
+		Name:       m.path,
+		Args:       m.args(a, pending, pinned),
+		Env:        []string{"DEBIAN_FRONTEND=noninteractive"},
+		InheritEnv: true,
+		Stream:     true,
+
+		BaseTask: gopack.BaseTask{RunContext: p.RunContext},
+	}
+	c.Run(action.Run)
+
+	after, err := m.versions(p.Ctx().Context(), specs)
+	if err != nil {
+		return false, err
+	}
+	if downgrade := m.downgrades(a, specs, after); len(downgrade) > 0 {
+		// yum install leaves a newer version than the pinned version installed
+		c.Args = append([]string{"downgrade", "-y"}, downgrade...)
+		c.Run(action.Run)
+		if after, err = m.versions(p.Ctx().Context(), specs); err != nil {
+			return false, err
+		}
+	}
+
+	changed := false
+	for _, s := range specs {
+		if before[s.name] == after[s.name] {
+			continue
+		}
+		changed = true
+		fmt.Fprintf(p.Ctx().NewTaskInfoWriter(), "%s %s -> %s\n", s.name, versionOrAbsent(before[s.name]), versionOrAbsent(after[s.name]))
+	}
+	for _, s := range specs {
+		if !s.satisfied(a, after[s.name]) {
+			return changed, fmt.Errorf("package %s is %s after %s, want %s", s.name, versionOrAbsent(after[s.name]), a, s.want())
+		}
+	}
+	return changed, nil
+}
+
+// wants returns the state the package has to change to for the action,
+// an empty string is returned if the package is already in the state
+func (p Package) wants(m packageManager, a action.Name, s packageSpec, have string) (string, error) {
+	switch {
+	case a == action.Remove:
+		if have == "" {
+			return "", nil
+		}
+		return "absent", nil
+	case have == "" || !versionMatches(have, s.version):
+		return s.want(), nil
+	case a == action.Upgrade && s.version == "":
+		up, err := m.upgradable(p.Ctx().Context(), s.name, have)
+		if err != nil || !up {
+			return "", err
+		}
+		return "latest", nil
+	}
+	return "", nil
+}
+
+// packageSpec is a package name and the version it's pinned to, the version is empty if it isn't pinned
+type packageSpec struct {
+	name    string
+	version string
+}
+
+func (s packageSpec) String() string {
+	if s.version == "" {
+		return s.name
+	}
+	return s.name + "=" + s.version
+}
+
+func (s packageSpec) want() string {
+	if s.version == "" {
+		return "present"
+	}
+	return s.version
+}
+
+// satisfied returns true if the installed version have is in the state of the action
+func (s packageSpec) satisfied(a action.Name, have string) bool {
+	if a == action.Remove {
+		return have == ""
+	}
+	return have != "" && versionMatches(have, s.version)
 }
 
-func (p Package) packageCommand() (Command, error) {
+func parsePackages(names []string) []packageSpec {
+	specs := []packageSpec{}
+	for _, n := range names {
+		x := strings.SplitN(n, "=", 2)
+		s := packageSpec{name: x[0]}
+		if len(x) == 2 {
+			s.version = x[1]
+		}
+		specs = append(specs, s)
+	}
+	return specs
+}
+
+// versionMatches returns true if have is the version want, or want without the release,
+// e.g. 1.2.3 matches 1.2.3-1.el7
+func versionMatches(have, want string) bool {
+	return want == "" || have == want || strings.HasPrefix(have, want+"-")
+}
+
+func versionOrAbsent(v string) string {
+	if v == "" {
+		return "absent"
+	}
+	return v
+}
+
+// packageManager queries and changes packages with apt-get and dpkg or yum and rpm
+type packageManager struct {
+	path string
+	apt  bool
+}
+
+func findPackageManager() (packageManager, error) {
 	path, err := exec.LookPath("apt-get")
 	if err != nil && err.(*exec.Error).Err != exec.ErrNotFound {
-		return Command{}, err
+		return packageManager{}, err
 	}
 	if err == nil {
-		args := []string{"install", "-y"}
-		args = append(args, p.Names...)
-		c := Command{
-			Name:   path,
-			Stream: true,
-			Args:   args,
-		}
-		return c, nil
+		return packageManager{path: path, apt: true}, nil
 	}
 
 	path, err = exec.LookPath("yum")
 	if err != nil && err.(*exec.Error).Err != exec.ErrNotFound {
-		return Command{}, err
+		return packageManager{}, err
 	}
 	if err == nil {
-		args := []string{"install", "-y"}
-		args = append(args, p.Names...)
-		c := Command{
-			Name:   path,
-			Stream: true,
-			Args:   args,
+		return packageManager{path: path}, nil
+	}
+	return packageManager{}, err
+}
+
+// args returns the args which change the packages for the action, apt-get is allowed to downgrade
+// packages to the versions they're pinned to
+func (m packageManager) args(a action.Name, names []string, pinned bool) []string {
+	args := []string{"install", "-y"}
+	switch {
+	case a == action.Remove:
+		args = []string{"remove", "-y"}
+	case m.apt && pinned:
+		args = append(args, "--allow-downgrades")
+	}
+	return append(args, names...)
+}
+
+// downgrades returns the pinned packages yum has to downgrade after they were installed
+func (m packageManager) downgrades(a action.Name, specs []packageSpec, versions map[string]string) []string {
+	names := []string{}
+	if m.apt || a == action.Remove {
+		return names
+	}
+	for _, s := range specs {
+		if have := versions[s.name]; s.version != "" && have != "" && !versionMatches(have, s.version) {
+			names = append(names, m.pin(s))
+		}
+	}
+	return names
+}
+
+func (m packageManager) pin(s packageSpec) string {
+	switch {
+	case s.version == "":
+		return s.name
+	case m.apt:
+		return s.name + "=" + s.version
+	default:
+		return s.name + "-" + s.version
+	}
+}
+
+// versions returns the installed versions of the packages, packages which aren't installed are left out
+func (m packageManager) versions(ctx context.Context, specs []packageSpec) (map[string]string, error) {
+	versions := map[string]string{}
+	for _, s := range specs {
+		v, installed, err := m.installed(ctx, s.name)
+		if err != nil {
+			return nil, err
+		}
+		if installed {
+			versions[s.name] = v
+		}
+	}
+	return versions, nil
+}
+
+// installed returns the version of the package if it's installed
+func (m packageManager) installed(ctx context.Context, name string) (string, bool, error) {
+	var (
+		out []byte
+		err error
+	)
+	if m.apt {
+		out, err = execCmd(ctx, packageQueryTimeout, "dpkg-query", nil, "", "-W", "-f=${Status} ${Version}\n", name)
+	} else {
+		out, err = execCmd(ctx, packageQueryTimeout, "rpm", nil, "", "-q", "--qf", "%{VERSION}-%{RELEASE}\n", name)
+	}
+	if _, ok := exitCode(err); ok {
+		// the query exits with non zero for packages it doesn't know
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("unable to query package %s, %s", name, err)
+	}
+	if m.apt {
+		v, installed := parseDpkgStatus(string(out))
+		return v, installed, nil
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 {
+		return "", false, nil
+	}
+	return lines[len(lines)-1], true, nil
+}
+
+// upgradable returns true if there is a newer version of the installed package
+func (m packageManager) upgradable(ctx context.Context, name, have string) (bool, error) {
+	if m.apt {
+		out, err := execCmd(ctx, packageQueryTimeout, "apt-cache", nil, "", "policy", name)
+		if err != nil {
+			return false, fmt.Errorf("unable to query package %s, %s", name, err)
+		}
+		candidate := parseAptCandidate(string(out))
+		return candidate != "" && candidate != "(none)" && candidate != have, nil
+	}
+	_, err := execCmd(ctx, packageQueryTimeout, m.path, nil, "", "check-update", "-q", name)
+	if code, ok := exitCode(err); ok && code == 100 {
+		// yum check-update exits with 100 if there are updates
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to query package %s, %s", name, err)
+	}
+	return false, nil
+}
+
+// parseDpkgStatus parses the ${Status} ${Version} output of dpkg-query
+func parseDpkgStatus(out string) (string, bool) {
+	x := strings.Fields(out)
+	if len(x) < 4 || x[2] != "installed" {
+		return "", false
+	}
+	return x[3], true
+}
+
+// parseAptCandidate returns the candidate version of apt-cache policy's output
+func parseAptCandidate(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Candidate:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Candidate:"))
 		}
-		return c, nil
 	}
-	return Command{}, err
+	return ""
 }
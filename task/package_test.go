@@ -0,0 +1,89 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"testing"
+
+	"github.com/mschenk42/gopack"
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackages(t *testing.T) {
+	assert := assert.New(t)
+
+	specs := parsePackages([]string{"nginx", "curl=7.58.0-2ubuntu3"})
+	assert.Equal([]packageSpec{{name: "nginx"}, {name: "curl", version: "7.58.0-2ubuntu3"}}, specs)
+	assert.Equal("curl=7.58.0-2ubuntu3", packageManager{apt: true}.pin(specs[1]))
+	assert.Equal("curl-7.58.0-2ubuntu3", packageManager{}.pin(specs[1]))
+	assert.Equal("nginx", packageManager{}.pin(specs[0]))
+
+	assert.Equal([]string{"install", "-y", "--allow-downgrades", "curl=1"}, packageManager{apt: true}.args(action.Install, []string{"curl=1"}, true))
+	assert.Equal([]string{"install", "-y", "curl-1"}, packageManager{}.args(action.Install, []string{"curl-1"}, true))
+	assert.Equal([]string{"remove", "-y", "curl"}, packageManager{apt: true}.args(action.Remove, []string{"curl"}, false))
+	assert.Equal([]string{"curl-7.58.0-2ubuntu3"}, packageManager{}.downgrades(action.Install, specs, map[string]string{"nginx": "1.0", "curl": "7.60.0-1"}))
+	assert.Empty(packageManager{}.downgrades(action.Install, specs, map[string]string{"curl": "7.58.0-2ubuntu3"}))
+
+	assert.True(specs[1].satisfied(action.Install, "7.58.0-2ubuntu3"))
+	assert.False(specs[1].satisfied(action.Install, "7.60.0-1"))
+	assert.False(specs[0].satisfied(action.Install, ""))
+	assert.True(specs[0].satisfied(action.Remove, ""))
+
+	assert.True(versionMatches("1.2.3-1.el7", ""))
+	assert.True(versionMatches("1.2.3-1.el7", "1.2.3"))
+	assert.True(versionMatches("1.2.3-1.el7", "1.2.3-1.el7"))
+	assert.False(versionMatches("1.2.30-1.el7", "1.2.3"))
+}
+
+func TestParsePackageQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	v, installed := parseDpkgStatus("install ok installed 8.28-1ubuntu1\n")
+	assert.True(installed)
+	assert.Equal("8.28-1ubuntu1", v)
+	_, installed = parseDpkgStatus("deinstall ok config-files 8.28-1ubuntu1\n")
+	assert.False(installed)
+
+	policy := `nginx:
+  Installed: 1.14.0-0ubuntu1
+  Candidate: 1.14.0-0ubuntu1.7
+  Version table:
+`
+	assert.Equal("1.14.0-0ubuntu1.7", parseAptCandidate(policy))
+	assert.Equal("", parseAptCandidate(""))
+}
+
+func TestPackageDryRun(t *testing.T) {
+	if _, err := exec.LookPath("dpkg-query"); err != nil {
+		t.Skip("dpkg-query not found")
+	}
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := gopack.NewRunContext(log.New(buf, "", 0))
+	rc.DryRun = true
+
+	status := Package{
+		Names:    []string{"coreutils", "gopack-no-such-package"},
+		BaseTask: gopack.BaseTask{RunContext: rc},
+	}.Run(action.Install, action.Remove)
+	assert.True(status[action.Install])
+	assert.True(status[action.Remove])
+	assert.Regexp("would install gopack-no-such-package", buf.String())
+	assert.NotRegexp("would install coreutils", buf.String())
+	assert.Regexp("would remove coreutils", buf.String())
+	assert.NotRegexp("would remove gopack-no-such-package", buf.String())
+
+	// install is the default action
+	buf.Reset()
+	status = Package{
+		Names:    []string{"gopack-no-such-package"},
+		BaseTask: gopack.BaseTask{RunContext: rc},
+	}.Run()
+	assert.True(status[action.Install])
+	assert.Regexp("would install gopack-no-such-package", buf.String())
+	fmt.Print(buf.String())
+}
@@ -0,0 +1,123 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mschenk42/gopack"
+	"github.com/mschenk42/gopack/action"
+)
+
+// Script runs a script body with an interpreter, e.g. bash or python3. The body is written to a
+// temp file which is passed to the interpreter before Args and removed after the script has run.
+type Script struct {
+	Interpreter string
+	Body        string
+	Args        []string
+	// Props renders the body as a text/template with the funcs of TemplateFuncs if it's set
+	Props *gopack.Properties
+
+	// Env, InheritEnv, Dir, Stream and Timeout are the same as Command's
+	Env        []string
+	InheritEnv bool
+	Dir        string
+	Stream     bool
+	Timeout    time.Duration
+	// Sensitive redacts the body and args when the script is logged
+	Sensitive bool
+
+	gopack.BaseTask
+}
+
+// Run initializes default property values and delegates to BaseTask RunActions method
+func (s Script) Run(runActions ...action.Name) gopack.ActionRunStatus {
+	s.setDefaults()
+	return s.RunActions(&s, s.registerActions(), runActions)
+}
+
+func (s Script) registerActions() action.Funcs {
+	return action.Funcs{
+		action.Run: s.run,
+	}
+}
+
+func (s *Script) setDefaults() {
+	if s.Interpreter == "" {
+		s.Interpreter = "sh"
+	}
+}
+
+// String returns a string which identifies the task with it's property values
+func (s Script) String() string {
+	body := strings.TrimSpace(s.Body)
+	if i := strings.Index(body, "\n"); i >= 0 {
+		body = body[:i] + " ..."
+	}
+	if s.Sensitive {
+		return fmt.Sprintf("script %s %v%s", s.Interpreter, Redact(s.Args...), Redact(body))
+	}
+	return fmt.Sprintf("script %s %v %s", s.Interpreter, s.Args, body)
+}
+
+func (s Script) run() (bool, error) {
+	body, err := s.render()
+	if err != nil {
+		return false, err
+	}
+	if s.DryRun() {
+		s.Would("run %s", s)
+		if s.Sensitive {
+			body = Redact(body)
+		}
+		fmt.Fprintln(s.Ctx().NewTaskInfoWriter(), body)
+		return true, nil
+	}
+
+	f, err := ioutil.TempFile("", "gopack-script")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to write script %s, %s", f.Name(), err)
+	}
+
+	c := Command{
+		Name:       s.Interpreter,
+		Args:       append([]string{f.Name()}, s.Args...),
+		Env:        s.Env,
+		InheritEnv: s.InheritEnv,
+		Dir:        s.Dir,
+		Stream:     s.Stream,
+		Sensitive:  s.Sensitive,
+		Timeout:    s.Timeout,
+
+		BaseTask: gopack.BaseTask{RunContext: s.RunContext},
+	}
+	c.setDefaults()
+	return c.run()
+}
+
+func (s Script) render() (string, error) {
+	if s.Props == nil {
+		return s.Body, nil
+	}
+	x, err := template.New("script").Funcs(TemplateFuncs("", false)).Parse(s.Body)
+	if err != nil {
+		return "", err
+	}
+	b := &bytes.Buffer{}
+	if err = x.Execute(b, s.Props); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,64 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mschenk42/gopack"
+	"github.com/mschenk42/gopack/action"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScript(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	props := &gopack.Properties{"greeting": "hello"}
+	body := `
+echo "{{.greeting}} $1"
+echo "path=$0"
+`
+	_, err := gopack.RunE(Script{Body: body, Args: []string{"world"}, Props: props}, action.Run)
+	assert.NoError(err)
+	assert.Contains(buf.String(), "hello world")
+
+	// the script's temp file is removed
+	i := strings.Index(buf.String(), "path=")
+	if assert.True(i >= 0) {
+		path := strings.TrimSpace(strings.SplitN(buf.String()[i+len("path="):], "\n", 2)[0])
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err))
+	}
+
+	_, err = gopack.RunE(Script{Interpreter: "bash", Body: "echo failed\nexit 2"}, action.Run)
+	cerr := &CmdError{}
+	if assert.ErrorAs(err, &cerr) {
+		assert.Equal(2, cerr.ExitCode)
+	}
+	fmt.Print(buf.String())
+}
+
+func TestScriptSensitive(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := gopack.NewRunContext(log.New(buf, "", 0))
+	rc.DryRun = true
+
+	s := Script{Body: "echo secret\necho more", Sensitive: true}
+	assert.NotContains(s.String(), "secret")
+
+	s.RunContext = rc
+	s.Run(action.Run)
+	assert.Contains(buf.String(), "would run script sh")
+	assert.NotContains(buf.String(), "secret")
+	fmt.Print(buf.String())
+}
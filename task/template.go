@@ -3,7 +3,9 @@ package task
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"text/template"
@@ -21,6 +23,24 @@ type Template struct {
 	Group  string
 	Perm   os.FileMode
 
+	// SourceFile is read for the source if Source is empty, it's read from FS if FS is set, e.g. an embed.FS
+	SourceFile string
+	FS         fs.FS
+	// Partials is a glob of templates the source can use, the templates are named by their file name
+	Partials string
+	// Funcs are added to the funcs of TemplateFuncs, DecryptKey is used by the decrypt func
+	Funcs         template.FuncMap
+	DecryptKey    string
+	DecryptBase64 bool
+
+	// Sensitive suppresses the diff of the file's content when it's updated, the diff is also
+	// suppressed if the template decrypts values
+	Sensitive bool
+	// Backup is the policy for backups of the file before it's updated
+	Backup Backup
+	// Verify is a command line run against the rendered file before it replaces the file, e.g. visudo -cf %{path}
+	Verify string
+
 	gopack.BaseTask
 }
 
@@ -45,6 +65,96 @@ func (t Template) String() string {
 	return fmt.Sprintf("template %s %s %s %s %s", t.Name, t.Path, t.Owner, t.Group, t.Perm)
 }
 
+// Diff returns the unified diff of the file and the rendered template without writing the file,
+// the content isn't shown if the template decrypts values
+func (t Template) Diff() (string, error) {
+	bt, decrypted, err := t.render()
+	if err != nil {
+		return "", err
+	}
+	bf, err := ioutil.ReadFile(t.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if decrypted && !bytes.Equal(bf, bt) {
+		return fmt.Sprintf("--- %s\n+++ %s\n@@ content not shown, it has decrypted values @@\n", t.Path, t.Path), nil
+	}
+	return UnifiedDiff(t.Path, t.Path, bf, bt), nil
+}
+
+// render executes the template, decrypted is true if the template called decrypt
+func (t Template) render() (b []byte, decrypted bool, err error) {
+	source, err := t.source()
+	if err != nil {
+		return nil, false, err
+	}
+	funcs := TemplateFuncs(t.DecryptKey, t.DecryptBase64)
+	for k, f := range t.Funcs {
+		funcs[k] = f
+	}
+	if decrypt, ok := funcs["decrypt"].(func(string) (string, error)); ok {
+		funcs["decrypt"] = func(encrypted string) (string, error) {
+			decrypted = true
+			return decrypt(encrypted)
+		}
+	}
+	x, err := template.New(t.Name).Funcs(funcs).Parse(source)
+	if err != nil {
+		return nil, false, err
+	}
+	if t.Partials != "" && t.FS != nil {
+		x, err = x.ParseFS(t.FS, t.Partials)
+	} else if t.Partials != "" {
+		x, err = x.ParseGlob(t.Partials)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	buf := &bytes.Buffer{}
+	if err = x.Execute(buf, t.Props); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), decrypted, nil
+}
+
+// write verifies the rendered file and backs up the file before it's replaced
+func (t Template) write(b []byte) error {
+	f, err := NewAtomicFile(t.Path, t.Perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Verify(t.Ctx(), t.Verify)
+	}
+	if err == nil {
+		err = BackupFile(t.Ctx(), t.Backup, t.Path)
+	}
+	if err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit(t.Owner, t.Group)
+}
+
+func (t Template) source() (string, error) {
+	if t.Source != "" || t.SourceFile == "" {
+		return t.Source, nil
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if t.FS != nil {
+		b, err = fs.ReadFile(t.FS, t.SourceFile)
+	} else {
+		b, err = ioutil.ReadFile(t.SourceFile)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read template source %s, %s", t.SourceFile, err)
+	}
+	return string(b), nil
+}
+
 func (t Template) create() (bool, error) {
 	var (
 		err          error
@@ -54,14 +164,12 @@ func (t Template) create() (bool, error) {
 		fileExists   bool
 		checkSumDiff bool
 		fi           os.FileInfo
+		sumt, sumf   [sha256.Size]byte
+		bt           []byte
+		decrypted    bool
 	)
 
-	x := template.New(t.Name)
-	if x, err = x.Parse(t.Source); err != nil {
-		return false, err
-	}
-	bt := &bytes.Buffer{}
-	if err = x.Execute(bt, t.Props); err != nil {
+	if bt, decrypted, err = t.render(); err != nil {
 		return false, err
 	}
 	if fi, fileExists, err = Fexists(t.Path); err != nil {
@@ -72,18 +180,32 @@ func (t Template) create() (bool, error) {
 		if bf, err = ioutil.ReadFile(t.Path); err != nil {
 			return false, err
 		}
-		sumt := sha256.Sum256(bt.Bytes())
-		sumf := sha256.Sum256(bf)
+		sumt = sha256.Sum256(bt)
+		sumf = sha256.Sum256(bf)
 		checkSumDiff = sumt != sumf
+		if checkSumDiff && !t.Sensitive && !decrypted {
+			t.Ctx().NewTaskInfoWriter().Write([]byte(UnifiedDiff(t.Path, t.Path, bf, bt)))
+		}
 	}
 	if !fileExists || checkSumDiff {
-		if err = ioutil.WriteFile(t.Path, bt.Bytes(), t.Perm); err != nil {
+		if t.DryRun() {
+			if fileExists {
+				t.WouldChange(gopack.Drift{Resource: t.Path, Attr: "sha256", Have: hex.EncodeToString(sumf[:]), Want: hex.EncodeToString(sumt[:])}, "update %s", t.Path)
+			} else {
+				t.WouldChange(gopack.Drift{Resource: t.Path, Attr: "state", Have: "absent", Want: "present"}, "create %s", t.Path)
+				return true, nil
+			}
+		} else if err = t.write(bt); err != nil {
 			return false, err
 		}
 		chgTemplate = true
 	} else {
 		if fi.Mode().Perm() != t.Perm.Perm() {
-			os.Chmod(t.Path, t.Perm)
+			if t.DryRun() {
+				t.WouldChange(ModeDrift(t.Path, fi.Mode(), t.Perm), "chmod %s from %s to %s", t.Path, fi.Mode().Perm(), t.Perm.Perm())
+			} else {
+				os.Chmod(t.Path, t.Perm)
+			}
 			chgMode = true
 		}
 	}
@@ -92,6 +214,12 @@ func (t Template) create() (bool, error) {
 	if t.Owner == "" && t.Group == "" {
 		return chgTemplate || chgOwnership || chgMode, nil
 	}
+	if t.DryRun() {
+		if chgOwnership, err = ChownRequired(t.Path, t.Owner, t.Group); chgOwnership {
+			t.WouldChange(OwnerDrift(t.Path, t.Owner, t.Group), "chown %s to %s:%s", t.Path, t.Owner, t.Group)
+		}
+		return chgTemplate || chgOwnership || chgMode, err
+	}
 	if chgOwnership, err = Chown(t.Path, t.Owner, t.Group); err != nil {
 		return chgTemplate || chgOwnership || chgMode, err
 	} else {
@@ -162,3 +162,93 @@ func TestModeChangedTemplate(t *testing.T) {
 	assert.Equal(2, len(re.FindAllSubmatch(buf.Bytes(), -1)))
 	fmt.Print(buf.String())
 }
+
+func TestTemplateDiff(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-diff-template"
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := fmt.Sprintf("%s/mypack.conf", testDir)
+	assert.NoError(ioutil.WriteFile(path, []byte("log_dir: /var/log/nginx\n"), 0755))
+
+	tmpl := Template{
+		Name:   "mypack",
+		Path:   path,
+		Source: "log_dir: {{ index . \"nginx.log_dir\"}}\n",
+		Props:  &gopack.Properties{"nginx.log_dir": "/var/log/other"},
+	}
+	diff, err := tmpl.Diff()
+	assert.NoError(err)
+	assert.Equal(fmt.Sprintf("--- %s\n+++ %s\n@@ -1,1 +1,1 @@\n-log_dir: /var/log/nginx\n+log_dir: /var/log/other\n", path, path), diff)
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("log_dir: /var/log/nginx\n", string(b))
+
+	sensitive := tmpl
+	sensitive.Sensitive = true
+	sensitive.Props = &gopack.Properties{"nginx.log_dir": "/var/log/secret"}
+	sensitive.Run(action.Create)
+	assert.NotRegexp(`secret`, buf.String())
+
+	tmpl.Run(action.Create)
+	assert.Regexp(`-log_dir: /var/log/secret`, buf.String())
+	assert.Regexp(`\+log_dir: /var/log/other`, buf.String())
+
+	// the diff of a template which decrypts values isn't shown
+	encrypted, key, err := Encrypt("/var/log/decrypted", "", false)
+	assert.NoError(err)
+	decrypt := tmpl
+	decrypt.Source = "log_dir: {{ index . \"nginx.log_dir\" | decrypt }}\n"
+	decrypt.Props = &gopack.Properties{"nginx.log_dir": encrypted}
+	decrypt.DecryptKey = key
+	diff, err = decrypt.Diff()
+	assert.NoError(err)
+	assert.NotRegexp(`/var/log/decrypted`, diff)
+	decrypt.Run(action.Create)
+	assert.NotRegexp(`/var/log/decrypted`, buf.String())
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal("log_dir: /var/log/decrypted\n", string(b))
+	fmt.Print(buf.String())
+}
+
+func TestTemplateVerify(t *testing.T) {
+	assert := assert.New(t)
+	const testDir = "/tmp/test-verify-template"
+
+	saveLogger := gopack.Log
+	buf := &bytes.Buffer{}
+	gopack.Log = log.New(buf, "", 0)
+	defer func() { gopack.Log = saveLogger }()
+
+	assert.NoError(os.MkdirAll(testDir, 0755))
+	defer func() { os.RemoveAll(testDir) }()
+	path := fmt.Sprintf("%s/app.conf", testDir)
+	assert.NoError(ioutil.WriteFile(path, []byte("valid: yes\n"), 0755))
+
+	tmpl := Template{
+		Name:   "app",
+		Path:   path,
+		Source: "valid: no\n",
+		Verify: "cat %{path} && grep -q 'valid: yes' %{path}",
+	}
+	_, err := gopack.RunE(tmpl, action.Create)
+	assert.Error(err)
+	assert.Regexp("verify `cat %{path} && grep -q 'valid: yes' %{path}` failed", err.Error())
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal("valid: yes\n", string(b))
+	infos, _ := ioutil.ReadDir(testDir)
+	assert.Len(infos, 1, "temp files should be removed")
+
+	tmpl.Source = "valid: yes\nworkers: 2\n"
+	_, err = gopack.RunE(tmpl, action.Create)
+	assert.NoError(err)
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal("valid: yes\nworkers: 2\n", string(b))
+	assert.Regexp(`(?m)^workers: 2$`, buf.String())
+	fmt.Print(buf.String())
+}
@@ -45,6 +45,10 @@ func (u User) create() (bool, error) {
 	if !strings.Contains(err.Error(), "unknown user") {
 		return false, err
 	}
+	if u.DryRun() {
+		u.WouldChange(gopack.Drift{Resource: "user " + u.Name, Attr: "state", Have: "absent", Want: "present"}, "create user %s", u.Name)
+		return true, nil
+	}
 	createUser(u)
 	return true, nil
 }
@@ -53,6 +57,10 @@ func (u User) remove() (bool, error) {
 	if _, err := user.Lookup(u.Name); err != nil {
 		return false, err
 	}
+	if u.DryRun() {
+		u.WouldChange(gopack.Drift{Resource: "user " + u.Name, Attr: "state", Have: "present", Want: "absent"}, "remove user %s", u.Name)
+		return true, nil
+	}
 	removeUser(u)
 	return true, nil
 }
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mschenk42/gopack"
 	"github.com/mschenk42/gopack/action"
 )
 
@@ -23,6 +24,8 @@ func createUser(u User) {
 		Name:    "useradd",
 		Args:    args,
 		Timeout: time.Second * 10,
+
+		BaseTask: gopack.BaseTask{RunContext: u.RunContext},
 	}.Run(action.Run)
 }
 
@@ -31,5 +34,7 @@ func removeUser(u User) {
 		Name:    "userdel",
 		Args:    []string{u.Name},
 		Timeout: time.Second * 10,
+
+		BaseTask: gopack.BaseTask{RunContext: u.RunContext},
 	}.Run(action.Run)
 }
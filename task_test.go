@@ -6,6 +6,7 @@ import (
 	"log"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/mschenk42/gopack/action"
 	"github.com/stretchr/testify/assert"
@@ -102,6 +103,62 @@ func TestGuards(t *testing.T) {
 	assert.NotPanics(func() { t1.Run(action.Create) })
 	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, "skipped due to not_if"), buf.String())
 	fmt.Print(buf.String())
+
+	buf.Reset()
+	t1 = Task1{
+		Name: "task1",
+		BaseTask: BaseTask{
+			OnlyIf: func() (bool, error) { return false, nil },
+			NotIf:  func() (bool, error) { return false, nil }},
+	}
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, "skipped due to only_if"), buf.String())
+	fmt.Print(buf.String())
+
+	// guards are combined with and, the guard which decided is logged
+	buf.Reset()
+	evaluated := 0
+	t1 = Task1{Name: "task1"}
+	t1.AddOnlyIf(Guard{Desc: "first", Cond: func() (bool, error) { evaluated++; return true, nil }})
+	t1.AddOnlyIf(Guard{Desc: "second", Cond: func() (bool, error) { evaluated++; return false, nil }})
+	t1.AddNotIf(Guard{Desc: "third", Cond: func() (bool, error) { evaluated++; return false, nil }})
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, "skipped due to only_if second"), buf.String())
+	assert.Equal(2, evaluated)
+	fmt.Print(buf.String())
+
+	buf.Reset()
+	t1 = Task1{Name: "task1"}
+	t1.AddOnlyIf(Guard{Desc: "first", Cond: func() (bool, error) { return true, nil }})
+	t1.AddNotIf(Guard{Desc: "second", Cond: func() (bool, error) { return false, nil }})
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, "run due to not_if second"), buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestGuardError(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := Log
+	buf := &bytes.Buffer{}
+	Log = log.New(buf, "", 0)
+	defer func() { Log = saveLogger }()
+
+	t1 := Task1{
+		Name:     "task1",
+		BaseTask: BaseTask{OnlyIf: func() (bool, error) { return true, fmt.Errorf("guard failed") }},
+	}
+	_, err := RunE(t1, action.Create)
+	assert.Error(err)
+	assert.Regexp(`! guard failed`, buf.String())
+
+	buf.Reset()
+	t1.ContOnError = true
+	_, err = RunE(t1, action.Create)
+	assert.NoError(err)
+	assert.Regexp(`~ guard failed`, buf.String())
+	assert.Regexp(`task1.*create.*skipped due to only_if error`, buf.String())
+	fmt.Print(buf.String())
 }
 
 func TestContOnError(t *testing.T) {
@@ -123,6 +180,70 @@ func TestContOnError(t *testing.T) {
 	fmt.Print(buf.String())
 }
 
+func TestRunE(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := Log
+	buf := &bytes.Buffer{}
+	Log = log.New(buf, "", 0)
+	defer func() { Log = saveLogger }()
+
+	t1 := Task2{
+		Name: "task2",
+	}
+
+	var err error
+	assert.NotPanics(func() { _, err = RunE(t1) })
+	assert.Error(err)
+	assert.IsType(&TaskError{}, err)
+	assert.Regexp(`! unable to run, no action given`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+
+	attempts := 0
+	t1 := Task3{
+		Name: "task3",
+		Func: func() (bool, error) {
+			attempts++
+			if attempts < 3 {
+				return false, fmt.Errorf("failure %d", attempts)
+			}
+			return true, nil
+		},
+		BaseTask: BaseTask{
+			RunContext:   rc,
+			Retries:      3,
+			RetryDelay:   10 * time.Millisecond,
+			RetryBackoff: 2,
+		},
+	}
+
+	start := time.Now()
+	assert.NotPanics(func() { t1.Run() })
+	assert.Equal(3, attempts)
+	assert.True(time.Since(start) >= 30*time.Millisecond)
+	assert.Regexp(`~ attempt 1 of 4 failed, retrying in 10ms, failure 1`, buf.String())
+	assert.Regexp(`~ attempt 2 of 4 failed, retrying in 20ms, failure 2`, buf.String())
+	assert.Regexp(fmt.Sprintf(`task3.*run.*%s`, passKeywords), buf.String())
+	fmt.Print(buf.String())
+
+	buf.Reset()
+	attempts = 0
+	t1.Retries = 1
+	_, err := RunE(t1)
+	assert.EqualError(err.(*TaskError).Err, "failure 2")
+	assert.Equal(2, attempts)
+	assert.Regexp(`~ attempt 1 of 2 failed`, buf.String())
+	assert.NotRegexp(`attempt 2`, buf.String())
+	fmt.Print(buf.String())
+}
+
 func TestWhenRun(t *testing.T) {
 	assert := assert.New(t)
 
@@ -172,7 +293,7 @@ func TestDelayedRun(t *testing.T) {
 
 	assert.NotPanics(func() { t1.Run(action.Create) })
 	assert.NotPanics(func() { t3.Run(action.Create) })
-	assert.NotPanics(func() { delayedNotify.Run() })
+	assert.NoError(DefaultRunContext.RunDelayed())
 	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, passKeywords), buf.String())
 	assert.Regexp(fmt.Sprintf(`task3.*create.*%s`, passKeywords), buf.String())
 	re := regexp.MustCompile(fmt.Sprintf(`task2 notified.*create.*%s`, passKeywords))
@@ -206,7 +327,7 @@ func TestDelayedChainedRun(t *testing.T) {
 	t3.SetNotify(t2, action.Create, action.Create, true)
 
 	assert.NotPanics(func() { t3.Run(action.Create) })
-	assert.NotPanics(func() { delayedNotify.Run() })
+	assert.NoError(DefaultRunContext.RunDelayed())
 	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, passKeywords), buf.String())
 	assert.Regexp(fmt.Sprintf(`task3.*create.*%s`, passKeywords), buf.String())
 	re := regexp.MustCompile(fmt.Sprintf(`task(1|2) notified.*create.*%s`, passKeywords))
@@ -216,6 +337,154 @@ func TestDelayedChainedRun(t *testing.T) {
 	fmt.Print(buf.String())
 }
 
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+
+	t1 := Task1{
+		Name:     "task1",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t2 := Task1{
+		Name:     "task2",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t3 := Task2{
+		Name:     "task3 subscribed",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t4 := Task2{
+		Name:     "task4 subscribed",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t3.SetSubscribe(&t3, &t1, action.Create, action.Create, true)
+	t3.SetSubscribe(&t3, &t2, action.Create, action.Create, true)
+	t2.SetNotify(t3, action.Create, action.Create, true)
+	t4.SetSubscribe(&t4, &t1, action.Create, action.Create, false)
+
+	// the subscribed tasks don't have to run to subscribe
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(fmt.Sprintf(`task4 subscribed.*create.*%s`, passKeywords), buf.String())
+	assert.NotRegexp(fmt.Sprintf(`task3 subscribed.*create.*%s`, passKeywords), buf.String())
+
+	assert.NotPanics(func() { t2.Run(action.Create) })
+	assert.NoError(rc.RunDelayed())
+	re := regexp.MustCompile(fmt.Sprintf(`task3 subscribed.*create.*%s`, passKeywords))
+	assert.Exactly(1, len(re.FindAllString(buf.String(), -1)), "task 3 notified more than once")
+
+	// a task which doesn't register nothing can't run it
+	_, err := RunE(Task1{Name: "task5", BaseTask: BaseTask{RunContext: rc}}, action.Nothing)
+	assert.Error(err)
+	assert.Regexp(`action not registered`, err.Error())
+
+	// tasks with the same property values are different tasks when given as pointers
+	other := Task1{Name: "task1", BaseTask: BaseTask{RunContext: rc}}
+	buf.Reset()
+	assert.NotPanics(func() { other.Run(action.Create) })
+	assert.NotRegexp(`subscribed`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestTags(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	rc := NewRunContext(log.New(buf, "", 0))
+	rc.Tags = []string{"config"}
+	rc.SkipTags = []string{"slow"}
+
+	t1 := Task1{
+		Name:     "task1",
+		BaseTask: BaseTask{RunContext: rc, Tags: []string{"config"}},
+	}
+	t2 := Task1{
+		Name:     "task2",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t3 := Task1{
+		Name:     "task3 notified",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t4 := Task1{
+		Name:     "task4",
+		BaseTask: BaseTask{RunContext: rc, Tags: []string{"config", "slow"}},
+	}
+	t5 := Task1{
+		Name:     "task5 not notified",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+	t1.SetNotify(t3, action.Create, action.Create, true)
+	t2.SetNotify(t5, action.Create, action.Create, false)
+
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.NotPanics(func() { t2.Run(action.Create) })
+	assert.NotPanics(func() { t4.Run(action.Create) })
+	assert.NoError(rc.RunDelayed())
+	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, passKeywords), buf.String())
+	assert.Regexp(`task2.*create.*skipped due to tags`, buf.String())
+	assert.Regexp(fmt.Sprintf(`task3 notified.*create.*%s`, passKeywords), buf.String())
+	assert.Regexp(`task4.*create.*skipped due to tags`, buf.String())
+	assert.NotRegexp(`task5`, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	saveLogger := Log
+	buf := &bytes.Buffer{}
+	Log = log.New(buf, "", 0)
+	defer func() { Log = saveLogger }()
+
+	rc := NewRunContext(nil)
+	rc.DryRun = true
+
+	t1 := Task1{
+		Name:     "task1",
+		BaseTask: BaseTask{RunContext: rc},
+	}
+
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(`task1.*create.*\(would run\)`, buf.String())
+	assert.NotRegexp(passKeywords, buf.String())
+	fmt.Print(buf.String())
+}
+
+func TestRunContexts(t *testing.T) {
+	assert := assert.New(t)
+
+	buf1 := &bytes.Buffer{}
+	rc1 := NewRunContext(log.New(buf1, "", 0))
+	buf2 := &bytes.Buffer{}
+	rc2 := NewRunContext(log.New(buf2, "", 0))
+
+	t1 := Task1{
+		Name:     "task1",
+		BaseTask: BaseTask{RunContext: rc1},
+	}
+	t2 := Task2{
+		Name:     "task2 notified",
+		BaseTask: BaseTask{RunContext: rc2},
+	}
+	t1.SetNotify(t2, action.Create, action.Create, true)
+
+	assert.NotPanics(func() { t1.Run(action.Create) })
+	assert.Regexp(fmt.Sprintf(`task1.*create.*%s`, passKeywords), buf1.String())
+	assert.Empty(buf2.String())
+	assert.Len(rc1.TasksRun(), 1)
+	assert.Len(rc2.TasksRun(), 0)
+
+	// delayed notifications are queued on the notifying task's context
+	assert.NoError(rc2.RunDelayed())
+	assert.Empty(buf2.String())
+	assert.NoError(rc1.RunDelayed())
+	assert.Regexp(fmt.Sprintf(`task2 notified.*create.*%s`, passKeywords), buf2.String())
+	assert.Len(rc2.TasksRun(), 1)
+	fmt.Print(buf1.String(), buf2.String())
+}
+
 type Task1 struct {
 	Name string
 
@@ -262,3 +531,21 @@ func (t Task2) create() (bool, error) {
 func (t Task2) nothing() (bool, error) {
 	return false, nil
 }
+
+type Task3 struct {
+	Name string
+	Func action.Func
+
+	BaseTask
+}
+
+func (t Task3) Run(runActions ...action.Name) ActionRunStatus {
+	regActions := action.Funcs{
+		action.Run: t.Func,
+	}
+	return t.BaseTask.RunActions(&t, regActions, runActions)
+}
+
+func (t Task3) String() string {
+	return t.Name
+}